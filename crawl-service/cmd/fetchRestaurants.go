@@ -14,11 +14,14 @@ import (
 )
 
 type Restaurant struct {
-	Name    string  `json:"name"`
-	Address string  `json:"address"`
-	Rating  float64 `json:"rating"`
-	PlaceID string  `json:"place_id"`
-	Area    string  `json:"area"`
+	Name    string   `json:"name"`
+	Address string   `json:"address"`
+	Rating  float64  `json:"rating"`
+	PlaceID string   `json:"place_id"`
+	Area    string   `json:"area"`
+	Types   []string `json:"types"`
+	Lat     float64  `json:"lat"`
+	Lng     float64  `json:"lng"`
 }
 
 type SearchRequest struct {
@@ -52,6 +55,8 @@ type Place struct {
 	DisplayName      DisplayName `json:"displayName"`
 	FormattedAddress string      `json:"formattedAddress"`
 	Rating           float64     `json:"rating"`
+	Types            []string    `json:"types"`
+	Location         Center      `json:"location"`
 }
 
 type DisplayName struct {
@@ -111,7 +116,7 @@ func fetchRestaurantsAtPoint(lat, lng float64, pointName string, rankBy string,
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Goog-Api-Key", googleKey)
-	req.Header.Set("X-Goog-FieldMask", "places.id,places.displayName,places.formattedAddress,places.rating")
+	req.Header.Set("X-Goog-FieldMask", "places.id,places.displayName,places.formattedAddress,places.rating,places.types,places.location")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -142,6 +147,9 @@ func fetchRestaurantsAtPoint(lat, lng float64, pointName string, rankBy string,
 			Rating:  place.Rating,
 			PlaceID: place.ID,
 			Area:    pointName,
+			Types:   place.Types,
+			Lat:     place.Location.Latitude,
+			Lng:     place.Location.Longitude,
 		}
 		restaurants = append(restaurants, restaurant)
 	}
@@ -86,6 +86,11 @@ func main() {
 		log.Printf("Error creating index: %v", err)
 	}
 
+	err = app.Models.RestaurantEntry.EnsureGeoIndex()
+	if err != nil {
+		log.Printf("Error creating geo index: %v", err)
+	}
+
 	fmt.Printf("Searching %d different areas in Daan District with coordinate variation...\n\n", len(searchPoints))
 
 	allRestaurants := make(map[string]Restaurant)
@@ -142,6 +147,12 @@ func main() {
 			Rating:  r.Rating,
 			PlaceID: r.PlaceID,
 			Area:    r.Area,
+			Types:   r.Types,
+		}
+
+		// places without coordinates are still drawable, just never by distance
+		if r.Lat != 0 || r.Lng != 0 {
+			restaurantPayload.Location = data.NewGeoPoint(r.Lat, r.Lng)
 		}
 
 		payloads = append(payloads, restaurantPayload)
@@ -156,7 +167,10 @@ func main() {
 
 	log.Println("start adding data to db")
 
-	app.Models.RestaurantEntry.InsertMany(payloads)
+	err = app.Models.RestaurantEntry.UpsertMany(payloads)
+	if err != nil {
+		log.Println("Error adding data to db", err)
+	}
 
 	log.Println("finished adding data to db")
 }
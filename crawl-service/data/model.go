@@ -32,10 +32,22 @@ type RestaurantEntry struct {
 	Rating    float64   `json:"rating"`
 	PlaceID   string    `json:"place_id"`
 	Area      string    `json:"area"`
+	Types     []string  `json:"types,omitempty"`
+	Location  *GeoPoint `bson:"location,omitempty" json:"location,omitempty"`
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }
 
+// GeoPoint is a GeoJSON point, coordinates are longitude first
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
 func (r *RestaurantEntry) EnsureUniqueIndex() error {
 	collection := client.Database("restaurants").Collection("restaurants")
 
@@ -57,6 +69,25 @@ func (r *RestaurantEntry) EnsureUniqueIndex() error {
 	return nil
 }
 
+// EnsureGeoIndex creates the 2dsphere index $geoNear needs on location
+func (r *RestaurantEntry) EnsureGeoIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	collection := client.Database("restaurants").Collection("restaurants")
+
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		log.Printf("Error creating geo index: %v", err)
+		return err
+	}
+
+	return nil
+}
+
 func (r *RestaurantEntry) Insert(entry RestaurantEntry) error {
 	collection := client.Database("restaurants").Collection("restaurants")
 
@@ -66,6 +97,8 @@ func (r *RestaurantEntry) Insert(entry RestaurantEntry) error {
 		Rating:    entry.Rating,
 		PlaceID:   entry.PlaceID,
 		Area:      entry.Area,
+		Types:     entry.Types,
+		Location:  entry.Location,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	})
@@ -78,22 +111,51 @@ func (r *RestaurantEntry) Insert(entry RestaurantEntry) error {
 	return nil
 }
 
-func (r *RestaurantEntry) InsertMany(entrys []RestaurantEntry) error {
+// UpsertMany inserts new places and refreshes the ones already in the catalog,
+// keyed on placeid so a re-crawl fills in fields older crawls did not have
+func (r *RestaurantEntry) UpsertMany(entrys []RestaurantEntry) error {
 	collection := client.Database("restaurants").Collection("restaurants")
 
-	opts := options.InsertMany().SetOrdered(false)
-	_, err := collection.InsertMany(context.TODO(), entrys, opts)
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(entrys))
+	for _, entry := range entrys {
+		if entry.PlaceID == "" {
+			log.Println("Skipping restaurant without a place id:", entry.Name)
+			continue
+		}
 
-	if err != nil {
-		// Check if it's just duplicate key errors (which we can ignore)
-		if mongo.IsDuplicateKeyError(err) {
-			log.Println("Some duplicates skipped (this is normal)")
-			return nil
+		set := bson.M{
+			"name":       entry.Name,
+			"address":    entry.Address,
+			"rating":     entry.Rating,
+			"area":       entry.Area,
+			"updated_at": now,
+		}
+		// a crawl that missed them should not wipe what an earlier one found
+		if len(entry.Types) > 0 {
+			set["types"] = entry.Types
 		}
-		log.Println("Error inserting restaurants:", err)
+		if entry.Location != nil {
+			set["location"] = entry.Location
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"placeid": entry.PlaceID}).
+			SetUpdate(bson.M{"$set": set, "$setOnInsert": bson.M{"created_at": now}}).
+			SetUpsert(true))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	opts := options.BulkWrite().SetOrdered(false)
+	result, err := collection.BulkWrite(context.TODO(), models, opts)
+	if err != nil {
+		log.Println("Error upserting restaurants:", err)
 		return err
 	}
 
+	log.Printf("Added %d restaurants, updated %d", result.UpsertedCount, result.ModifiedCount)
 	return nil
 }
 
@@ -111,6 +173,7 @@ func (l *RestaurantEntry) All() ([]*RestaurantEntry, error) {
 
 	if err != nil {
 		log.Println("Finding all doc error", err)
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 
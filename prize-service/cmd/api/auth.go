@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+var (
+	errUnauthorized = newError(CodeUnauthorized, "authentication required")
+	errForbidden    = newError(CodeForbidden, "you do not have access to this draw")
+	errOwnerOnly    = newError(CodeForbidden, "only the owner can manage sharing")
+	errAdminOnly    = newError(CodeForbidden, "only admins can manage restaurants")
+)
+
+func sharesKey(uId string) string {
+	return fmt.Sprintf("draw:%s:shares", uId)
+}
+
+// parseAPIKeys reads API_KEYS, a comma separated list of key:user pairs
+func parseAPIKeys(value string) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, user, ok := strings.Cut(pair, ":")
+		if !ok || key == "" || user == "" {
+			return nil, fmt.Errorf("invalid api key entry %q, expected key:user", pair)
+		}
+		keys[key] = user
+	}
+	return keys, nil
+}
+
+func (app *Config) userForAPIKey(key string) (string, bool) {
+	for candidate, user := range app.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			return user, true
+		}
+	}
+	return "", false
+}
+
+func (app *Config) userForToken(token string) (string, error) {
+	if len(app.JWTSecret) == 0 {
+		return "", errors.New("token authentication is not configured")
+	}
+
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		return app.JWTSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+
+	if claims.Subject == "" {
+		return "", errors.New("token has no subject")
+	}
+	return claims.Subject, nil
+}
+
+// authenticate resolves the user of an X-API-Key header or a bearer token, requests
+// without credentials carry on anonymously
+func (app *Config) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user string
+
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			var ok bool
+			user, ok = app.userForAPIKey(key)
+			if !ok {
+				app.errorJson(w, newError(CodeUnauthorized, "invalid api key"))
+				return
+			}
+		} else if header := r.Header.Get("Authorization"); header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				app.errorJson(w, newError(CodeUnauthorized, "authorization header must be a bearer token"))
+				return
+			}
+
+			var err error
+			user, err = app.userForToken(strings.TrimSpace(token))
+			if err != nil {
+				app.errorJson(w, wrapError(CodeUnauthorized, err))
+				return
+			}
+		} else if token := r.URL.Query().Get("access_token"); token != "" {
+			// browsers cannot set headers on EventSource and WebSocket connections
+			var err error
+			user, err = app.userForToken(token)
+			if err != nil {
+				app.errorJson(w, wrapError(CodeUnauthorized, err))
+				return
+			}
+		}
+
+		if user != "" {
+			r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func authUser(r *http.Request) string {
+	user, _ := r.Context().Value(userContextKey).(string)
+	return user
+}
+
+func (app *Config) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authUser(r) == "" {
+			if shareToken(r) != "" {
+				app.errorJson(w, errReadOnlyShare)
+				return
+			}
+			app.errorJson(w, errUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseAdminUsers reads ADMIN_USERS, a comma separated list of user names
+func parseAdminUsers(value string) map[string]bool {
+	admins := map[string]bool{}
+	for _, user := range strings.Split(value, ",") {
+		user = strings.TrimSpace(user)
+		if user != "" {
+			admins[user] = true
+		}
+	}
+	return admins
+}
+
+// parseTeams reads TEAMS, a comma separated list of team:user pairs with one pair
+// per member, e.g. lunch:alice,lunch:bob
+func parseTeams(value string) (map[string]map[string]bool, error) {
+	teams := map[string]map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		team, user, ok := strings.Cut(pair, ":")
+		team = strings.ToLower(strings.TrimSpace(team))
+		user = strings.TrimSpace(user)
+		if !ok || team == "" || user == "" {
+			return nil, fmt.Errorf("invalid team entry %q, expected team:user", pair)
+		}
+
+		if teams[team] == nil {
+			teams[team] = map[string]bool{}
+		}
+		teams[team][user] = true
+	}
+	return teams, nil
+}
+
+// requireAdmin guards the shared restaurant catalog, it runs after requireUser
+func (app *Config) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.AdminUsers[authUser(r)] {
+			app.errorJson(w, errAdminOnly)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isDrawOwner is true for the owner of the draw. draws created before ownership
+// existed have none, admins manage them and can share them with whoever ran them
+func (app *Config) isDrawOwner(meta *DrawMeta, user string) bool {
+	if meta.Owner == "" {
+		return app.AdminUsers[user]
+	}
+	return meta.Owner == user
+}
+
+// canAccessDraw is true for the owner and the users the draw is shared with
+func (app *Config) canAccessDraw(ctx context.Context, meta *DrawMeta, user string) (bool, error) {
+	if app.isDrawOwner(meta, user) {
+		return true, nil
+	}
+	return app.Rdb.SIsMember(ctx, sharesKey(meta.ID), user).Result()
+}
+
+func (app *Config) checkDrawAccess(ctx context.Context, r *http.Request, uId string) error {
+	meta, err := app.drawMeta(ctx, uId)
+	if err != nil {
+		return err
+	}
+
+	ok, err := app.canAccessDraw(ctx, meta, authUser(r))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errForbidden
+	}
+	return nil
+}
+
+// drawAccess guards the /draws/{id} routes
+func (app *Config) drawAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := app.checkDrawAccess(context.Background(), r, chi.URLParam(r, "id"))
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ownerOnly loads the draw for handlers only its owner may use
+func (app *Config) ownerOnly(ctx context.Context, r *http.Request, uId string) (*DrawMeta, error) {
+	meta, err := app.drawMeta(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+	if !app.isDrawOwner(meta, authUser(r)) {
+		return nil, errOwnerOnly
+	}
+	return meta, nil
+}
+
+func (app *Config) writeShares(w http.ResponseWriter, uId string) {
+	users, err := app.Rdb.SMembers(context.Background(), sharesKey(uId)).Result()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	slices.Sort(users)
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data: struct {
+			Users []string `json:"users"`
+		}{
+			Users: users,
+		},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) GetShares(w http.ResponseWriter, r *http.Request) {
+	app.writeShares(w, chi.URLParam(r, "id"))
+}
+
+func (app *Config) ShareDraw(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	var requestPayload struct {
+		User string `json:"user"`
+	}
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	user := strings.TrimSpace(requestPayload.User)
+	if user == "" {
+		app.errorJson(w, newError(CodeBadRequest, "user is required"))
+		return
+	}
+
+	meta, err := app.ownerOnly(ctx, r, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	pipe := app.Rdb.TxPipeline()
+	pipe.SAdd(ctx, sharesKey(uId), user)
+	pipe.ExpireAt(ctx, sharesKey(uId), meta.ExpiresAt.Add(drawRetention))
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.writeShares(w, uId)
+}
+
+func (app *Config) UnshareDraw(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	_, err := app.ownerOnly(ctx, r, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	err = app.Rdb.SRem(ctx, sharesKey(uId), chi.URLParam(r, "user")).Err()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.writeShares(w, uId)
+}
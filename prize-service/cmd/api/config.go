@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebPort         = "80"
+	defaultReadTimeout     = 15 * time.Second
+	defaultWriteTimeout    = 30 * time.Second
+	defaultIdleTimeout     = 60 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+var defaultAllowedOrigins = []string{
+	"https://m790101.github.io",
+	"https://m790101.github.io/prize-draw",
+	"http://localhost:5174",
+}
+
+type ServerConfig struct {
+	Port         string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// how long in-flight requests get to finish once SIGTERM arrives
+	ShutdownTimeout time.Duration
+	AllowedOrigins  []string
+	// only these may tell us the client address through X-Forwarded-For
+	TrustedProxies []netip.Prefix
+}
+
+// loadServerConfig reads flags, every flag falls back to its environment variable
+func loadServerConfig() (ServerConfig, error) {
+	var cfg ServerConfig
+	var origins, proxies string
+
+	readTimeout, err := envDuration("READ_TIMEOUT", defaultReadTimeout)
+	if err != nil {
+		return cfg, err
+	}
+	writeTimeout, err := envDuration("WRITE_TIMEOUT", defaultWriteTimeout)
+	if err != nil {
+		return cfg, err
+	}
+	idleTimeout, err := envDuration("IDLE_TIMEOUT", defaultIdleTimeout)
+	if err != nil {
+		return cfg, err
+	}
+	shutdownTimeout, err := envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	if err != nil {
+		return cfg, err
+	}
+
+	flag.StringVar(&cfg.Port, "port", envString("PORT", defaultWebPort), "port to listen on (PORT)")
+	flag.DurationVar(&cfg.ReadTimeout, "read-timeout", readTimeout, "maximum time to read a request (READ_TIMEOUT)")
+	flag.DurationVar(&cfg.WriteTimeout, "write-timeout", writeTimeout, "maximum time to write a response, event streams are exempt (WRITE_TIMEOUT)")
+	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", idleTimeout, "how long keep-alive connections stay open (IDLE_TIMEOUT)")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", shutdownTimeout, "how long to drain requests on shutdown (SHUTDOWN_TIMEOUT)")
+	flag.StringVar(&origins, "cors-origins", envString("CORS_ORIGINS", strings.Join(defaultAllowedOrigins, ",")), "comma separated origins allowed to call the api (CORS_ORIGINS)")
+	flag.StringVar(&proxies, "trusted-proxies", envString("TRUSTED_PROXIES", ""), "comma separated addresses or CIDRs of proxies whose forwarded client address is used (TRUSTED_PROXIES)")
+	flag.Parse()
+
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin != "" {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+		}
+	}
+	if len(cfg.AllowedOrigins) == 0 {
+		return cfg, fmt.Errorf("at least one CORS origin is required")
+	}
+
+	cfg.TrustedProxies, err = parseTrustedProxies(proxies)
+	if err != nil {
+		return cfg, err
+	}
+
+	for name, timeout := range map[string]time.Duration{
+		"read timeout":     cfg.ReadTimeout,
+		"write timeout":    cfg.WriteTimeout,
+		"idle timeout":     cfg.IdleTimeout,
+		"shutdown timeout": cfg.ShutdownTimeout,
+	} {
+		if timeout <= 0 {
+			return cfg, fmt.Errorf("%s must be positive", name)
+		}
+	}
+
+	return cfg, nil
+}
+
+// parseTrustedProxies reads a list of CIDRs, a bare address trusts just that host
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range strings.Split(value, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return duration, nil
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"prize-service/data"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+type DrawEntry struct {
+	Name     string `json:"name"`
+	Weight   int    `json:"weight"`
+	Quantity int    `json:"quantity"`
+	Group    string `json:"group,omitempty"`
+}
+
+// UnmarshalJSON fills in a weight and quantity of one for the fields the
+// client left out, a zero that was sent is still a zero and gets rejected
+func (entry *DrawEntry) UnmarshalJSON(b []byte) error {
+	type plain DrawEntry
+	decoded := plain{Weight: 1, Quantity: 1}
+	err := json.Unmarshal(b, &decoded)
+	if err != nil {
+		return err
+	}
+	*entry = DrawEntry(decoded)
+	return nil
+}
+
+type NewDrawRequest struct {
+	Names      []string    `json:"names"`
+	Entries    []DrawEntry `json:"entries"`
+	Fair       bool        `json:"fair"`
+	ClientSeed string      `json:"clientSeed"`
+	IgnoreCase bool        `json:"ignoreCase"`
+	Title      string      `json:"title"`
+	Owner      string      `json:"-"`
+	ExpiresAt  *time.Time  `json:"expiresAt"`
+	// draws of the same event can skip people who already won in one of them
+	Event          string `json:"event"`
+	ExcludeWinners bool   `json:"excludeWinners"`
+
+	// groups of plain names, weighted entries carry their own
+	groups map[string]string
+}
+
+type CreatedDraw struct {
+	ID        uuid.UUID `json:"id"`
+	SeedHash  string    `json:"seedHash,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+const maxDrawCount = 1000
+
+var errNotEnoughEntries = newError(CodeNotEnoughEntries, "not enough entries left")
+
+// pops ARGV[1] names from the list, or returns how many could be drawn when that is
+// too few. KEYS[2] collects the winners of the event, with ARGV[2] set its members
+// are passed over in this draw and stay in the list
+var listDrawScript = redis.NewScript(`
+local count = tonumber(ARGV[1])
+if redis.call('LLEN', KEYS[1]) == 0 then
+	return false
+end
+local winners = {}
+if ARGV[2] == '1' then
+	local names = redis.call('LRANGE', KEYS[1], 0, -1)
+	for i = #names, 1, -1 do
+		if #winners < count and redis.call('SISMEMBER', KEYS[2], names[i]) == 0 then
+			table.insert(winners, names[i])
+		end
+	end
+	if #winners < count then
+		return #winners
+	end
+	for _, name in ipairs(winners) do
+		redis.call('LREM', KEYS[1], -1, name)
+	end
+else
+	local left = redis.call('LLEN', KEYS[1])
+	if left < count then
+		return left
+	end
+	for n = 1, count do
+		table.insert(winners, redis.call('RPOP', KEYS[1]))
+	end
+end
+if KEYS[2] then
+	redis.call('SADD', KEYS[2], unpack(winners))
+end
+return winners
+`)
+
+// picks one name from the stock hash per random value in ARGV[3..], every unit left
+// counts weight times, returns the units left when there are too few. KEYS[3] and
+// ARGV[1] work like in listDrawScript, like ARGV[2] the event winners sit this draw
+// out and keep their stock
+var weightedDrawScript = redis.NewScript(`
+local stock = redis.call('HGETALL', KEYS[1])
+local pool = {}
+local units = 0
+local held = false
+local count = #ARGV - 2
+for i = 1, #stock, 2 do
+	local left = tonumber(stock[i + 1])
+	if left > 0 and (stock[i] == ARGV[2] or (ARGV[1] == '1' and redis.call('SISMEMBER', KEYS[3], stock[i]) == 1)) then
+		held = true
+		left = 0
+	end
+	if left > 0 then
+		local weight = tonumber(redis.call('HGET', KEYS[2], stock[i]) or '1')
+		units = units + left
+		table.insert(pool, {name = stock[i], weight = weight, left = left})
+	end
+end
+if units == 0 and not held then
+	return false
+end
+if units < count then
+	return units
+end
+local winners = {}
+for n = 1, count do
+	local total = 0
+	for _, item in ipairs(pool) do
+		total = total + item.weight * item.left
+	end
+	local target = tonumber(ARGV[n + 2]) * total
+	local picked = nil
+	for _, item in ipairs(pool) do
+		if item.left > 0 then
+			picked = item
+			target = target - item.weight * item.left
+			if target < 0 then
+				break
+			end
+		end
+	end
+	picked.left = picked.left - 1
+	redis.call('HINCRBY', KEYS[1], picked.name, -1)
+	table.insert(winners, picked.name)
+end
+if KEYS[3] then
+	redis.call('SADD', KEYS[3], unpack(winners))
+end
+return winners
+`)
+
+func drawKey(uId string) string {
+	return fmt.Sprintf("draw:%s", uId)
+}
+
+func weightsKey(uId string) string {
+	return fmt.Sprintf("draw:%s:weights", uId)
+}
+
+func stockKey(uId string) string {
+	return fmt.Sprintf("draw:%s:stock", uId)
+}
+
+func groupsKey(uId string) string {
+	return fmt.Sprintf("draw:%s:groups", uId)
+}
+
+// createDraw validates the request and stores the pool, the seed and the metadata of a new draw
+func (app *Config) createDraw(ctx context.Context, req NewDrawRequest) (*CreatedDraw, error) {
+	var err error
+	if len(req.Entries) > 0 {
+		req.Entries, err = validateEntries(req.Entries, req.IgnoreCase)
+	} else {
+		req.Names, err = validateNames(req.Names, req.IgnoreCase)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req.Event = strings.TrimSpace(req.Event)
+	if req.ExcludeWinners {
+		if req.Event == "" {
+			return nil, newError(CodeBadRequest, "excludeWinners needs an event")
+		}
+		if req.Fair {
+			return nil, newError(CodeBadRequest, "fair draws cannot skip winners of other draws")
+		}
+	}
+
+	uId := uuid.New()
+	created := &CreatedDraw{ID: uId}
+
+	meta := DrawMeta{
+		ID:        uId.String(),
+		Title:     req.Title,
+		Owner:     req.Owner,
+		Status:    drawStatusOpen,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(defaultDrawLifetime),
+
+		Event:          req.Event,
+		ExcludeWinners: req.ExcludeWinners,
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(meta.CreatedAt) {
+			return nil, newError(CodeBadRequest, "expiresAt must be in the future")
+		}
+		meta.ExpiresAt = *req.ExpiresAt
+	}
+
+	// weighted entries keep their stock in hashes instead of a list
+	if len(req.Entries) > 0 {
+		if req.Fair {
+			return nil, errFairNamesOnly
+		}
+
+		err = app.saveEntries(ctx, uId.String(), req.Entries)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		names := req.Names
+		var seed *FairSeed
+
+		if req.Fair {
+			// commit to the seed now, it is revealed once the draw is over
+			serverSeed, err := newServerSeed()
+			if err != nil {
+				return nil, err
+			}
+			seed = &FairSeed{
+				SeedHash:   hashSeed(serverSeed),
+				ServerSeed: serverSeed,
+				ClientSeed: req.ClientSeed,
+				Names:      names,
+			}
+
+			created.SeedHash = seed.SeedHash
+			names = fairShuffle(names, seed.ServerSeed, seed.ClientSeed)
+		} else {
+			// make Names to a random slice
+			shuffleStrings(names)
+		}
+
+		// add to list with randomize names & drawId, a fair draw never has a list without its seed
+		_, err = app.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.LPush(ctx, drawKey(uId.String()), names)
+			if seed != nil {
+				return saveFairSeed(ctx, pipe, uId.String(), *seed)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(req.groups) > 0 {
+		err = app.Rdb.HSet(ctx, groupsKey(uId.String()), req.groups).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = app.saveDrawMeta(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.Event != "" {
+		err = app.Rdb.SAdd(ctx, eventDrawsKey(meta.Owner, meta.Event), meta.ID).Err()
+		if err != nil {
+			return nil, err
+		}
+		app.expireEvent(ctx, &meta)
+	}
+
+	created.ExpiresAt = meta.ExpiresAt
+	return created, nil
+}
+
+func shuffleStrings(names []string) {
+	rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+}
+
+func (app *Config) saveEntries(ctx context.Context, uId string, entries []DrawEntry) error {
+	weights := make(map[string]any, len(entries))
+	stock := make(map[string]any, len(entries))
+	groups := make(map[string]any)
+
+	for _, entry := range entries {
+		weights[entry.Name] = entry.Weight
+		stock[entry.Name] = entry.Quantity
+		if entry.Group != "" {
+			groups[entry.Name] = entry.Group
+		}
+	}
+
+	pipe := app.Rdb.TxPipeline()
+	pipe.Del(ctx, drawKey(uId), weightsKey(uId), stockKey(uId), groupsKey(uId))
+	pipe.HSet(ctx, weightsKey(uId), weights)
+	pipe.HSet(ctx, stockKey(uId), stock)
+	if len(groups) > 0 {
+		pipe.HSet(ctx, groupsKey(uId), groups)
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (app *Config) isWeighted(ctx context.Context, uId string) (bool, error) {
+	exists, err := app.Rdb.Exists(ctx, stockKey(uId)).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
+
+// drawMany pops count winners in one script call, returns redis.Nil when
+// nothing is left and errNotEnoughEntries when fewer than count remain. skip
+// sits this draw out, list names are unique so only stock can hold it
+func (app *Config) drawMany(ctx context.Context, meta *DrawMeta, count int, skip string) ([]string, error) {
+	uId := meta.ID
+
+	weighted, err := app.isWeighted(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+
+	// winners of a draw linked to an event are collected for its sibling draws
+	var eventKeys []string
+	if meta.Event != "" {
+		eventKeys = append(eventKeys, eventWinnersKey(meta.Owner, meta.Event))
+	}
+	exclude := "0"
+	if meta.ExcludeWinners {
+		exclude = "1"
+	}
+
+	var result any
+	if weighted {
+		keys := append([]string{stockKey(uId), weightsKey(uId)}, eventKeys...)
+		args := make([]any, count+2)
+		args[0] = exclude
+		args[1] = skip
+		for i := 2; i < len(args); i++ {
+			args[i] = strconv.FormatFloat(rand.Float64(), 'f', -1, 64)
+		}
+		result, err = weightedDrawScript.Run(ctx, app.Rdb, keys, args...).Result()
+	} else {
+		keys := append([]string{drawKey(uId)}, eventKeys...)
+		result, err = listDrawScript.Run(ctx, app.Rdb, keys, count, exclude).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch result := result.(type) {
+	case int64:
+		return nil, fmt.Errorf("%w: %d of %d requested", errNotEnoughEntries, result, count)
+	case []any:
+		winners := make([]string, 0, len(result))
+		for _, name := range result {
+			winners = append(winners, fmt.Sprint(name))
+		}
+		return winners, nil
+	}
+	return nil, fmt.Errorf("unexpected draw result %T", result)
+}
+
+type DrawRun struct {
+	UId       string
+	Count     int
+	Requester string
+	Round     int
+	Prize     string
+	// a forfeited winner is kept out of their own replacement
+	Skip string
+}
+
+// runDraw pops the winners of an open draw, records them in the history and
+// tells subscribers about them. the warning is set when the history could not be
+// stored yet, the winners are final either way
+func (app *Config) runDraw(ctx context.Context, run DrawRun) ([]string, string, error) {
+	meta, err := app.drawMeta(ctx, run.UId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch meta.Status {
+	case drawStatusClosed:
+		return nil, "", errDrawClosed
+	case drawStatusExhausted:
+		return nil, "", errDrawExhausted
+	}
+
+	winners, err := app.drawMany(ctx, meta, run.Count, run.Skip)
+	if errors.Is(err, redis.Nil) {
+		app.setDrawStatus(ctx, run.UId, drawStatusExhausted)
+		return nil, "", errDrawExhausted
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if meta.Event != "" {
+		app.expireEvent(ctx, meta)
+	}
+
+	remaining, err := app.remaining(ctx, run.UId)
+	if err != nil {
+		log.Println("Error counting remaining entries", err)
+	}
+
+	if err == nil && remaining == 0 {
+		err = app.setDrawStatus(ctx, run.UId, drawStatusExhausted)
+		if err != nil {
+			log.Println("Error updating draw status", err)
+		}
+	}
+
+	// the popped values are gone from redis, keep a record of them
+	history := make([]data.DrawHistoryEntry, 0, len(winners))
+	for i, winner := range winners {
+		history = append(history, data.DrawHistoryEntry{
+			DrawID:    run.UId,
+			Winner:    winner,
+			Requester: run.Requester,
+			Remaining: remaining + int64(len(winners)-i-1),
+			Round:     run.Round,
+			Prize:     run.Prize,
+			Timestamp: time.Now(),
+		})
+	}
+	warning := ""
+	err = app.saveHistory(ctx, meta, history)
+	if err != nil {
+		// the winners are already out of the pool, failing here would only make a
+		// retry draw a second set
+		log.Println("Error saving draw history, retrying in the background", err, winners)
+		go app.retryHistory(*meta, history)
+		warning = historyPendingWarning
+	}
+
+	app.publishDrawEvent(ctx, DrawEvent{
+		Type:      drawEventDraw,
+		DrawID:    run.UId,
+		Names:     winners,
+		Remaining: remaining,
+		Round:     run.Round,
+		Prize:     run.Prize,
+	})
+
+	return winners, warning, nil
+}
+
+func (app *Config) remaining(ctx context.Context, uId string) (int64, error) {
+	weighted, err := app.isWeighted(ctx, uId)
+	if err != nil {
+		return 0, err
+	}
+
+	if !weighted {
+		return app.Rdb.LLen(ctx, drawKey(uId)).Result()
+	}
+
+	stock, err := app.Rdb.HVals(ctx, stockKey(uId)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, left := range stock {
+		n, err := strconv.ParseInt(left, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestApp runs the app against an in-memory redis, nothing here reaches mongo
+func newTestApp(t *testing.T) (*Config, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return &Config{Rdb: rdb}, mr
+}
+
+func TestWeightedDraw(t *testing.T) {
+	app, mr := newTestApp(t)
+	ctx := context.Background()
+	meta := &DrawMeta{ID: "weighted"}
+
+	err := app.saveEntries(ctx, meta.ID, []DrawEntry{
+		{Name: "mug", Weight: 1, Quantity: 2},
+		{Name: "trip", Weight: 5, Quantity: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	winners, err := app.drawMany(ctx, meta, 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(winners)
+	if want := []string{"mug", "mug", "trip"}; !slices.Equal(winners, want) {
+		t.Errorf("winners = %v, want every unit once %v", winners, want)
+	}
+
+	for _, name := range []string{"mug", "trip"} {
+		if left := mr.HGet(stockKey(meta.ID), name); left != "0" {
+			t.Errorf("stock of %s = %s, want 0", name, left)
+		}
+	}
+
+	_, err = app.drawMany(ctx, meta, 1, "")
+	if !errors.Is(err, redis.Nil) {
+		t.Errorf("draw from empty stock error = %v, want redis.Nil", err)
+	}
+}
+
+func TestWeightedDrawFavoursWeight(t *testing.T) {
+	app, _ := newTestApp(t)
+	ctx := context.Background()
+	meta := &DrawMeta{ID: "weighted"}
+
+	heavy := 0
+	for i := 0; i < 200; i++ {
+		err := app.saveEntries(ctx, meta.ID, []DrawEntry{
+			{Name: "light", Weight: 1, Quantity: 1},
+			{Name: "heavy", Weight: 99, Quantity: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		winners, err := app.drawMany(ctx, meta, 1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if winners[0] == "heavy" {
+			heavy++
+		}
+	}
+
+	// 198 expected, anything near an even split means weights are ignored
+	if heavy < 150 {
+		t.Errorf("heavy won %d of 200 draws, want most of them", heavy)
+	}
+}
+
+func TestDrawManyIsAllOrNothing(t *testing.T) {
+	app, mr := newTestApp(t)
+	ctx := context.Background()
+
+	list := &DrawMeta{ID: "list"}
+	mr.Push(drawKey(list.ID), "a", "b", "c")
+
+	weighted := &DrawMeta{ID: "weighted"}
+	err := app.saveEntries(ctx, weighted.ID, []DrawEntry{
+		{Name: "mug", Weight: 1, Quantity: 2},
+		{Name: "trip", Weight: 1, Quantity: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, meta := range []*DrawMeta{list, weighted} {
+		_, err = app.drawMany(ctx, meta, 4, "")
+		if !errors.Is(err, errNotEnoughEntries) {
+			t.Errorf("%s: drawing 4 of 3 error = %v, want errNotEnoughEntries", meta.ID, err)
+		}
+		if left, _ := app.remaining(ctx, meta.ID); left != 3 {
+			t.Errorf("%s: %d left after a refused draw, want all 3", meta.ID, left)
+		}
+	}
+
+	winners, err := app.drawMany(ctx, list, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(winners) != 2 || winners[0] == winners[1] {
+		t.Errorf("winners = %v, want two different names", winners)
+	}
+	names, _ := mr.List(drawKey(list.ID))
+	if len(names) != 1 || slices.Contains(winners, names[0]) {
+		t.Errorf("list = %v after drawing %v, want the one name left", names, winners)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/redis/go-redis/v9"
+)
+
+const maxPoolRetries = 5
+
+var (
+	errEntryExists   = newError(CodeConflict, "entry is already in the pool")
+	errEntryNotFound = newError(CodeNotFound, "entry not found in the pool")
+)
+
+func sameName(a, b string, ignoreCase bool) bool {
+	if ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// modifyPool rewrites the remaining list in a watched transaction and reshuffles it,
+// names that were already drawn are not touched. fair draws keep the names they
+// committed to
+func (app *Config) modifyPool(ctx context.Context, meta *DrawMeta, change func(names []string) ([]string, error)) error {
+	uId := meta.ID
+	key := drawKey(uId)
+
+	seed, err := app.fairSeed(ctx, uId)
+	if err != nil {
+		return err
+	}
+	if seed != nil {
+		return errFairPoolLocked
+	}
+
+	txf := func(tx *redis.Tx) error {
+		names, err := tx.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		names, err = change(names)
+		if err != nil {
+			return err
+		}
+		shuffleStrings(names)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			if len(names) > 0 {
+				pipe.LPush(ctx, key, names)
+				pipe.ExpireAt(ctx, key, meta.ExpiresAt.Add(drawRetention))
+			}
+			return nil
+		})
+		return err
+	}
+
+	return app.watchPool(ctx, txf, key)
+}
+
+// findWeighted returns the stored name that matches name, or "" when there is none
+func findWeighted(ctx context.Context, tx *redis.Tx, uId, name string, ignoreCase bool) (string, error) {
+	if !ignoreCase {
+		exists, err := tx.HExists(ctx, weightsKey(uId), name).Result()
+		if err != nil || !exists {
+			return "", err
+		}
+		return name, nil
+	}
+
+	names, err := tx.HKeys(ctx, weightsKey(uId)).Result()
+	if err != nil {
+		return "", err
+	}
+	for _, existing := range names {
+		if sameName(existing, name, true) {
+			return existing, nil
+		}
+	}
+	return "", nil
+}
+
+func (app *Config) addWeightedEntry(ctx context.Context, uId string, entry DrawEntry, ignoreCase bool) error {
+	txf := func(tx *redis.Tx) error {
+		existing, err := findWeighted(ctx, tx, uId, entry.Name, ignoreCase)
+		if err != nil {
+			return err
+		}
+		if existing != "" {
+			return errEntryExists
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, weightsKey(uId), entry.Name, entry.Weight)
+			pipe.HSet(ctx, stockKey(uId), entry.Name, entry.Quantity)
+			return nil
+		})
+		return err
+	}
+
+	return app.watchPool(ctx, txf, weightsKey(uId))
+}
+
+// removeWeightedEntry returns the name the entry was stored under
+func (app *Config) removeWeightedEntry(ctx context.Context, uId, name string, ignoreCase bool) (string, error) {
+	var removed string
+
+	txf := func(tx *redis.Tx) error {
+		existing, err := findWeighted(ctx, tx, uId, name, ignoreCase)
+		if err != nil {
+			return err
+		}
+		if existing == "" {
+			return errEntryNotFound
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, weightsKey(uId), existing)
+			pipe.HDel(ctx, stockKey(uId), existing)
+			return nil
+		})
+		removed = existing
+		return err
+	}
+
+	err := app.watchPool(ctx, txf, weightsKey(uId))
+	return removed, err
+}
+
+// watchPool runs txf until none of the watched keys changed under it
+func (app *Config) watchPool(ctx context.Context, txf func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxPoolRetries; i++ {
+		err := app.Rdb.Watch(ctx, txf, keys...)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return err
+	}
+	return redis.TxFailedErr
+}
+
+// openDrawForChange loads the draw and refuses changes to closed draws
+func (app *Config) openDrawForChange(ctx context.Context, uId string) (*DrawMeta, error) {
+	meta, err := app.drawMeta(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Status == drawStatusClosed {
+		return nil, errDrawClosed
+	}
+	return meta, nil
+}
+
+type AddEntryRequest struct {
+	DrawEntry
+	IgnoreCase bool `json:"ignoreCase"`
+}
+
+// UnmarshalJSON decodes the entry on its own, its UnmarshalJSON would otherwise
+// take over the whole body and drop ignoreCase
+func (req *AddEntryRequest) UnmarshalJSON(b []byte) error {
+	err := json.Unmarshal(b, &req.DrawEntry)
+	if err != nil {
+		return err
+	}
+
+	var options struct {
+		IgnoreCase bool `json:"ignoreCase"`
+	}
+	err = json.Unmarshal(b, &options)
+	req.IgnoreCase = options.IgnoreCase
+	return err
+}
+
+func (app *Config) AddEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	var requestPayload AddEntryRequest
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	entries, err := validateEntries([]DrawEntry{requestPayload.DrawEntry}, requestPayload.IgnoreCase)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	entry := entries[0]
+
+	meta, err := app.openDrawForChange(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	weighted, err := app.isWeighted(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if weighted {
+		err = app.addWeightedEntry(ctx, uId, entry, requestPayload.IgnoreCase)
+	} else {
+		err = app.modifyPool(ctx, meta, func(names []string) ([]string, error) {
+			for _, name := range names {
+				if sameName(name, entry.Name, requestPayload.IgnoreCase) {
+					return nil, errEntryExists
+				}
+			}
+			return append(names, entry.Name), nil
+		})
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if entry.Group != "" {
+		err = app.Rdb.HSet(ctx, groupsKey(uId), entry.Name, entry.Group).Err()
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		app.Rdb.ExpireAt(ctx, groupsKey(uId), meta.ExpiresAt.Add(drawRetention))
+	}
+
+	if meta.Status == drawStatusExhausted {
+		err = app.setDrawStatus(ctx, uId, drawStatusOpen)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	app.poolChanged(w, uId)
+}
+
+func (app *Config) RemoveEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+	name := normalizeName(chi.URLParam(r, "name"))
+	ignoreCase := r.URL.Query().Get("ignoreCase") == "true"
+
+	meta, err := app.openDrawForChange(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	weighted, err := app.isWeighted(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// groups are keyed by the name as stored, which can differ in case
+	removed := name
+	if weighted {
+		removed, err = app.removeWeightedEntry(ctx, uId, name, ignoreCase)
+	} else {
+		err = app.modifyPool(ctx, meta, func(names []string) ([]string, error) {
+			for i, existing := range names {
+				if sameName(existing, name, ignoreCase) {
+					removed = existing
+					return slices.Delete(names, i, i+1), nil
+				}
+			}
+			return nil, errEntryNotFound
+		})
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.Rdb.HDel(ctx, groupsKey(uId), removed)
+
+	app.poolChanged(w, uId)
+}
+
+// poolChanged tells subscribers about the new pool size and answers with it
+func (app *Config) poolChanged(w http.ResponseWriter, uId string) {
+	ctx := context.Background()
+
+	remaining, err := app.remaining(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.publishDrawEvent(ctx, DrawEvent{
+		Type:      drawEventUpdate,
+		DrawID:    uId,
+		Remaining: remaining,
+	})
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data: struct {
+			Remaining int64 `json:"remaining"`
+		}{
+			Remaining: remaining,
+		},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type ErrorCode string
+
+const (
+	CodeBadRequest          ErrorCode = "BAD_REQUEST"
+	CodeValidationFailed    ErrorCode = "VALIDATION_FAILED"
+	CodeIdempotencyMismatch ErrorCode = "IDEMPOTENCY_KEY_MISMATCH"
+	CodeUnauthorized        ErrorCode = "UNAUTHORIZED"
+	CodeForbidden           ErrorCode = "FORBIDDEN"
+	CodeNotFound            ErrorCode = "NOT_FOUND"
+	CodeDrawNotFound        ErrorCode = "DRAW_NOT_FOUND"
+	CodeConflict            ErrorCode = "CONFLICT"
+	CodeDrawClosed          ErrorCode = "DRAW_CLOSED"
+	CodeDrawExhausted       ErrorCode = "DRAW_EXHAUSTED"
+	CodeNotEnoughEntries    ErrorCode = "NOT_ENOUGH_ENTRIES"
+	CodeRateLimited         ErrorCode = "RATE_LIMITED"
+	CodeInternal            ErrorCode = "INTERNAL_ERROR"
+	CodeUpstreamUnavailable ErrorCode = "UPSTREAM_UNAVAILABLE"
+)
+
+type errorKind struct {
+	httpStatus int
+	// Status of the JsonResponse envelope, successful responses keep "200"
+	status string
+}
+
+var errorKinds = map[ErrorCode]errorKind{
+	CodeBadRequest:          {http.StatusBadRequest, "4000"},
+	CodeValidationFailed:    {http.StatusUnprocessableEntity, "4220"},
+	CodeIdempotencyMismatch: {http.StatusUnprocessableEntity, "4221"},
+	CodeUnauthorized:        {http.StatusUnauthorized, "4010"},
+	CodeForbidden:           {http.StatusForbidden, "4030"},
+	CodeNotFound:            {http.StatusNotFound, "4040"},
+	CodeDrawNotFound:        {http.StatusNotFound, "4041"},
+	CodeConflict:            {http.StatusConflict, "4090"},
+	CodeDrawClosed:          {http.StatusConflict, "4091"},
+	CodeDrawExhausted:       {http.StatusConflict, "4092"},
+	CodeNotEnoughEntries:    {http.StatusConflict, "4093"},
+	CodeRateLimited:         {http.StatusTooManyRequests, "4290"},
+	CodeInternal:            {http.StatusInternalServerError, "5000"},
+	CodeUpstreamUnavailable: {http.StatusServiceUnavailable, "5030"},
+}
+
+// APIError carries the code a handler answers with, errors without one are
+// treated as internal or upstream failures
+type APIError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func newError(code ErrorCode, message string) *APIError {
+	return &APIError{Code: code, Err: errors.New(message)}
+}
+
+func errorf(code ErrorCode, format string, args ...any) *APIError {
+	return &APIError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+func wrapError(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &APIError{Code: code, Err: err}
+}
+
+func isUpstreamError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, redis.ErrClosed) ||
+		mongo.IsTimeout(err) ||
+		mongo.IsNetworkError(err)
+}
+
+func errorCode(err error) ErrorCode {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return CodeValidationFailed
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+
+	if isUpstreamError(err) {
+		return CodeUpstreamUnavailable
+	}
+	return CodeInternal
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+var errEventNotFound = newError(CodeNotFound, "event not found")
+
+type EventGroup struct {
+	ID      string   `json:"id"`
+	Draws   []string `json:"draws"`
+	Winners []string `json:"winners"`
+}
+
+// events belong to the owner of their draws, two users can both have a "party".
+// the owner is escaped so it cannot run into the event name
+func eventKey(owner, event string) string {
+	return fmt.Sprintf("event:%s:%s", url.QueryEscape(owner), event)
+}
+
+func eventDrawsKey(owner, event string) string {
+	return eventKey(owner, event) + ":draws"
+}
+
+func eventWinnersKey(owner, event string) string {
+	return eventKey(owner, event) + ":winners"
+}
+
+// expireEvent keeps the event keys around as long as the longest lived draw linked to it
+func (app *Config) expireEvent(ctx context.Context, meta *DrawMeta) {
+	expireAt := meta.ExpiresAt.Add(drawRetention)
+
+	for _, key := range []string{eventDrawsKey(meta.Owner, meta.Event), eventWinnersKey(meta.Owner, meta.Event)} {
+		ttl, err := app.Rdb.TTL(ctx, key).Result()
+		if err != nil {
+			log.Println("Error reading event ttl", err)
+			continue
+		}
+		if ttl < time.Until(expireAt) {
+			app.Rdb.ExpireAt(ctx, key, expireAt)
+		}
+	}
+}
+
+// GetEvent only looks at the caller's own events
+func (app *Config) GetEvent(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	event := chi.URLParam(r, "id")
+	owner := authUser(r)
+
+	draws, err := app.Rdb.SMembers(ctx, eventDrawsKey(owner, event)).Result()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	if len(draws) == 0 {
+		app.errorJson(w, errEventNotFound)
+		return
+	}
+
+	winners, err := app.Rdb.SMembers(ctx, eventWinnersKey(owner, event)).Result()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	slices.Sort(draws)
+	slices.Sort(winners)
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data: EventGroup{
+			ID:      event,
+			Draws:   draws,
+			Winners: winners,
+		},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
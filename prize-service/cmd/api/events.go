@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	drawEventDraw   = "draw"
+	drawEventUpdate = "update"
+	drawEventClose  = "close"
+
+	eventKeepAlive = 15 * time.Second
+)
+
+type DrawEvent struct {
+	Type      string    `json:"type"`
+	DrawID    string    `json:"drawId"`
+	Names     []string  `json:"names,omitempty"`
+	Remaining int64     `json:"remaining"`
+	Round     int       `json:"round,omitempty"`
+	Prize     string    `json:"prize,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (app *Config) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || slices.Contains(app.allowedOrigins(), origin)
+}
+
+func eventsChannel(uId string) string {
+	return fmt.Sprintf("draw:%s:events", uId)
+}
+
+// publishDrawEvent goes through redis pub/sub so subscribers on every replica get it
+func (app *Config) publishDrawEvent(ctx context.Context, event DrawEvent) {
+	event.Timestamp = time.Now()
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error encoding draw event", err)
+		return
+	}
+
+	err = app.Rdb.Publish(ctx, eventsChannel(event.DrawID), message).Err()
+	if err != nil {
+		log.Println("Error publishing draw event", err)
+	}
+}
+
+func (app *Config) DrawEvents(w http.ResponseWriter, r *http.Request) {
+	uId := chi.URLParam(r, "id")
+
+	_, err := app.drawMeta(context.Background(), uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.streamEvents(w, r, eventsChannel(uId))
+}
+
+// streamEvents relays a pub/sub channel as server-sent events, every message
+// carries its event name in a type field
+func (app *Config) streamEvents(w http.ResponseWriter, r *http.Request, channel string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.errorJson(w, newError(CodeInternal, "streaming is not supported"))
+		return
+	}
+
+	// the stream outlives the server write timeout, keep-alives notice dead clients instead
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Println("Error clearing write deadline", err)
+	}
+
+	sub := app.Rdb.Subscribe(r.Context(), channel)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-app.shutdown:
+			// EventSource reconnects on its own, ideally to another replica
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var event struct {
+				Type string `json:"type"`
+			}
+			err := json.Unmarshal([]byte(msg.Payload), &event)
+			if err != nil {
+				log.Println("Error decoding event", err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, msg.Payload)
+			flusher.Flush()
+		}
+	}
+}
+
+func (app *Config) DrawEventsWS(w http.ResponseWriter, r *http.Request) {
+	uId := chi.URLParam(r, "id")
+
+	_, err := app.drawMeta(context.Background(), uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: app.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Error upgrading websocket", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// the client only ever sends control frames, reading notices when it goes away
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sub := app.Rdb.Subscribe(ctx, eventsChannel(uId))
+	defer sub.Close()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.shutdown:
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(5*time.Second))
+			return
+		case <-keepAlive.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
+			if err != nil {
+				return
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"prize-service/data"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jung-kurt/gofpdf"
+)
+
+type ExportedWinner struct {
+	Position int       `json:"position"`
+	Name     string    `json:"name"`
+	Group    string    `json:"group,omitempty"`
+	Prize    string    `json:"prize,omitempty"`
+	DrawnAt  time.Time `json:"drawnAt"`
+}
+
+type DrawExport struct {
+	ID       string           `json:"id"`
+	Title    string           `json:"title"`
+	Status   string           `json:"status"`
+	SeedHash string           `json:"seedHash,omitempty"`
+	Digest   string           `json:"digest"`
+	Winners  []ExportedWinner `json:"winners"`
+}
+
+// drawExport checks access itself, the export has to outlive the draw keys
+func (app *Config) drawExport(ctx context.Context, r *http.Request, uId string) (*DrawExport, error) {
+	meta, err := app.drawMeta(ctx, uId)
+	if errors.Is(err, errDrawNotFound) {
+		return app.archivedExport(r, uId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := app.canAccessDraw(ctx, meta, authUser(r))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errForbidden
+	}
+
+	export := &DrawExport{
+		ID:     uId,
+		Title:  meta.Title,
+		Status: meta.Status,
+	}
+
+	seed, err := app.fairSeed(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+	if seed != nil {
+		export.SeedHash = seed.SeedHash
+	}
+
+	groups, err := app.Rdb.HGetAll(ctx, groupsKey(uId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := app.drawHistory(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+
+	return export, export.fill(history, groups)
+}
+
+// archivedExport rebuilds the results of an expired draw from the history in mongo,
+// the owner went with the keys so the users who drew and the admins may export it
+func (app *Config) archivedExport(r *http.Request, uId string) (*DrawExport, error) {
+	history, err := app.Models.DrawHistoryEntry.AllByDraw(uId)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, errDrawNotFound
+	}
+
+	user := authUser(r)
+	if !app.AdminUsers[user] && !slices.ContainsFunc(history, func(entry *data.DrawHistoryEntry) bool {
+		return entry.Requester == user
+	}) {
+		return nil, errForbidden
+	}
+
+	export := &DrawExport{
+		ID:     uId,
+		Status: drawStatusClosed,
+	}
+	return export, export.fill(history, nil)
+}
+
+// fill lists the winners that were not forfeited and signs them with the digest
+func (export *DrawExport) fill(history []*data.DrawHistoryEntry, groups map[string]string) error {
+	export.Winners = []ExportedWinner{}
+	for _, entry := range history {
+		if entry.Forfeited {
+			continue
+		}
+		export.Winners = append(export.Winners, ExportedWinner{
+			Position: len(export.Winners) + 1,
+			Name:     entry.Winner,
+			Group:    groups[entry.Winner],
+			Prize:    entry.Prize,
+			DrawnAt:  entry.Timestamp,
+		})
+	}
+
+	// the digest covers the csv rows so any copy of the results can be checked against it
+	rows, err := exportCsv(export)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(rows)
+	export.Digest = hex.EncodeToString(sum[:])
+	return nil
+}
+
+// csvCell keeps spreadsheets from running names as formulas
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func exportCsv(export *DrawExport) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	writer.Write([]string{"position", "name", "group", "prize", "drawn_at"})
+	for _, winner := range export.Winners {
+		writer.Write([]string{
+			strconv.Itoa(winner.Position),
+			csvCell(winner.Name),
+			csvCell(winner.Group),
+			csvCell(winner.Prize),
+			winner.DrawnAt.UTC().Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+
+	return buf.Bytes(), writer.Error()
+}
+
+// exportPdf renders the results sheet, PDF_FONT_PATH points to a utf-8 ttf font for names
+// outside latin-1
+func exportPdf(export *DrawExport) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	font := "Helvetica"
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+
+	if fontPath := os.Getenv("PDF_FONT_PATH"); fontPath != "" {
+		fontBytes, err := os.ReadFile(fontPath)
+		if err != nil {
+			return nil, err
+		}
+		pdf.AddUTF8FontFromBytes("results", "", fontBytes)
+		font = "results"
+		translate = func(s string) string { return s }
+	}
+
+	pdf.SetTitle("Draw results", true)
+	pdf.AddPage()
+
+	pdf.SetFont(font, "", 20)
+	pdf.CellFormat(0, 12, translate("Official Draw Results"), "", 1, "C", false, 0, "")
+
+	pdf.SetFont(font, "", 11)
+	pdf.Ln(4)
+	pdf.CellFormat(0, 7, translate("Draw: "+export.Title), "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 7, "Draw ID: "+export.ID, "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 7, "Status: "+export.Status, "", 1, "L", false, 0, "")
+	if export.SeedHash != "" {
+		pdf.CellFormat(0, 7, "Seed hash (SHA-256): "+export.SeedHash, "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	pdf.SetFillColor(230, 230, 230)
+	pdf.CellFormat(15, 8, "#", "1", 0, "C", true, 0, "")
+	pdf.CellFormat(80, 8, "Winner", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(35, 8, "Group", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(60, 8, "Drawn at (UTC)", "1", 1, "L", true, 0, "")
+
+	for _, winner := range export.Winners {
+		pdf.CellFormat(15, 8, strconv.Itoa(winner.Position), "1", 0, "C", false, 0, "")
+		pdf.CellFormat(80, 8, translate(winner.Name), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(35, 8, translate(winner.Group), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(60, 8, winner.DrawnAt.UTC().Format("2006-01-02 15:04:05"), "1", 1, "L", false, 0, "")
+	}
+
+	pdf.Ln(10)
+	pdf.SetFont(font, "", 9)
+	pdf.MultiCell(0, 5, "Results digest (SHA-256 of the CSV export): "+export.Digest, "", "L", false)
+	pdf.MultiCell(0, 5, "Generated "+time.Now().UTC().Format(time.RFC1123), "", "L", false)
+
+	pdf.Ln(15)
+	pdf.CellFormat(70, 6, "", "B", 1, "L", false, 0, "")
+	pdf.CellFormat(70, 6, "Draw supervisor", "", 1, "L", false, 0, "")
+
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (app *Config) ExportDraw(w http.ResponseWriter, r *http.Request) {
+	uId := chi.URLParam(r, "id")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "pdf" {
+		app.errorJson(w, newError(CodeBadRequest, "format must be one of csv, json or pdf"))
+		return
+	}
+
+	export, err := app.drawExport(context.Background(), r, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	filename := fmt.Sprintf("draw-%s.%s", uId, format)
+	headers := http.Header{}
+	headers.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var out []byte
+	var contentType string
+
+	switch format {
+	case "json":
+		payload := JsonResponse{
+			Status:  "200",
+			Message: "",
+			Data:    export,
+		}
+
+		app.writeJson(w, http.StatusOK, payload, headers)
+		return
+	case "csv":
+		out, err = exportCsv(export)
+		contentType = "text/csv; charset=utf-8"
+	case "pdf":
+		out, err = exportPdf(export)
+		contentType = "application/pdf"
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
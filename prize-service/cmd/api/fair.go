@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	errNotFair        = newError(CodeNotFound, "draw is not a fair draw")
+	errFairNamesOnly  = newError(CodeBadRequest, "fair mode only supports names")
+	errFairPoolLocked = newError(CodeConflict, "entries of a fair draw cannot change once its seed hash is published")
+)
+
+type FairSeed struct {
+	SeedHash   string   `json:"seedHash"`
+	ServerSeed string   `json:"serverSeed,omitempty"`
+	ClientSeed string   `json:"clientSeed"`
+	Names      []string `json:"names,omitempty"`
+}
+
+func fairKey(uId string) string {
+	return fmt.Sprintf("draw:%s:fair", uId)
+}
+
+func newServerSeed() (string, error) {
+	seed := make([]byte, 32)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(seed), nil
+}
+
+func hashSeed(serverSeed string) string {
+	sum := sha256.Sum256([]byte(serverSeed))
+	return hex.EncodeToString(sum[:])
+}
+
+// seedStream yields uint64s from HMAC-SHA256(serverSeed, "<clientSeed>:<counter>"),
+// four per block, read big endian
+type seedStream struct {
+	serverSeed string
+	clientSeed string
+	counter    uint64
+	block      []byte
+}
+
+func (s *seedStream) next() uint64 {
+	if len(s.block) == 0 {
+		mac := hmac.New(sha256.New, []byte(s.serverSeed))
+		fmt.Fprintf(mac, "%s:%d", s.clientSeed, s.counter)
+		s.block = mac.Sum(nil)
+		s.counter++
+	}
+	v := binary.BigEndian.Uint64(s.block[:8])
+	s.block = s.block[8:]
+	return v
+}
+
+// intn returns a uniform value in [0, n) by rejecting the biased top of the range
+func (s *seedStream) intn(n int) int {
+	limit := math.MaxUint64 - math.MaxUint64%uint64(n)
+	for {
+		v := s.next()
+		if v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// fairShuffle is a Fisher-Yates shuffle from the last index down, the first
+// name of the result is drawn first
+func fairShuffle(names []string, serverSeed, clientSeed string) []string {
+	order := slices.Clone(names)
+	stream := &seedStream{serverSeed: serverSeed, clientSeed: clientSeed}
+
+	for i := len(order) - 1; i > 0; i-- {
+		j := stream.intn(i + 1)
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// saveFairSeed queues the seed on pipe, so it lands together with the list it shuffled
+func saveFairSeed(ctx context.Context, pipe redis.Pipeliner, uId string, seed FairSeed) error {
+	names, err := json.Marshal(seed.Names)
+	if err != nil {
+		return err
+	}
+
+	pipe.HSet(ctx, fairKey(uId),
+		"seed_hash", seed.SeedHash,
+		"server_seed", seed.ServerSeed,
+		"client_seed", seed.ClientSeed,
+		"names", names,
+	)
+	return nil
+}
+
+// fairSeed returns nil when the draw was not created in fair mode
+func (app *Config) fairSeed(ctx context.Context, uId string) (*FairSeed, error) {
+	fields, err := app.Rdb.HGetAll(ctx, fairKey(uId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	seed := FairSeed{
+		SeedHash:   fields["seed_hash"],
+		ServerSeed: fields["server_seed"],
+		ClientSeed: fields["client_seed"],
+	}
+	err = json.Unmarshal([]byte(fields["names"]), &seed.Names)
+	if err != nil {
+		return nil, err
+	}
+	return &seed, nil
+}
+
+// shuffleNames orders names for a new list. the seed hash of a fair draw commits
+// to its names as well, so those never get a new list
+func (app *Config) shuffleNames(ctx context.Context, uId string, names []string) ([]string, error) {
+	seed, err := app.fairSeed(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+	if seed != nil {
+		return nil, errFairPoolLocked
+	}
+
+	shuffleStrings(names)
+	return names, nil
+}
+
+func (app *Config) DrawSeed(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	seed, err := app.fairSeed(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	if seed == nil {
+		app.errorJson(w, errNotFair)
+		return
+	}
+
+	meta, err := app.drawMeta(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// the server seed stays secret until the draw is closed or exhausted
+	if meta.Status == drawStatusOpen {
+		seed.ServerSeed = ""
+		seed.Names = nil
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    seed,
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) VerifyDraw(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		UId        string   `json:"uId"`
+		SeedHash   string   `json:"seedHash"`
+		ServerSeed string   `json:"serverSeed"`
+		ClientSeed string   `json:"clientSeed"`
+		Names      []string `json:"names"`
+		Winners    []string `json:"winners"`
+	}
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.ServerSeed == "" {
+		app.errorJson(w, newError(CodeBadRequest, "serverSeed is required"))
+		return
+	}
+
+	// a draw id pulls the committed hash and the recorded winners, which are only
+	// for those who could read the draw anyway
+	if requestPayload.UId != "" {
+		err = app.checkDrawReadAccess(context.Background(), r, requestPayload.UId)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+
+		seed, err := app.fairSeed(context.Background(), requestPayload.UId)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		if seed == nil {
+			app.errorJson(w, errNotFair)
+			return
+		}
+		requestPayload.SeedHash = seed.SeedHash
+
+		history, err := app.drawHistory(context.Background(), requestPayload.UId)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		requestPayload.Winners = nil
+		for _, entry := range history {
+			requestPayload.Winners = append(requestPayload.Winners, entry.Winner)
+		}
+	}
+
+	order := fairShuffle(requestPayload.Names, requestPayload.ServerSeed, requestPayload.ClientSeed)
+
+	seedHashMatches := hashSeed(requestPayload.ServerSeed) == requestPayload.SeedHash
+	winnersMatch := len(requestPayload.Winners) <= len(order) &&
+		slices.Equal(requestPayload.Winners, order[:len(requestPayload.Winners)])
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data: struct {
+			Verified        bool     `json:"verified"`
+			SeedHashMatches bool     `json:"seedHashMatches"`
+			WinnersMatch    bool     `json:"winnersMatch"`
+			Order           []string `json:"order"`
+		}{
+			Verified:        seedHashMatches && winnersMatch,
+			SeedHashMatches: seedHashMatches,
+			WinnersMatch:    winnersMatch,
+			Order:           order,
+		},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// the vectors come from an independent implementation of the published algorithm,
+// outside verifiers rely on every byte of it so none of them may change
+const (
+	vectorServerSeed = "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0"
+	vectorClientSeed = "office-party-2026"
+)
+
+var vectorNames = []string{"Alice", "Bob", "Carol", "Dave", "Erin", "Frank", "Grace", "Heidi", "Ivan", "Judy"}
+
+func TestHashSeed(t *testing.T) {
+	want := "331ab04caa328927f706627b812f4139f9ec42a6d61f17e468a70c41a48d8f67"
+	if got := hashSeed(vectorServerSeed); got != want {
+		t.Errorf("hashSeed() = %s, want %s", got, want)
+	}
+}
+
+func TestSeedStream(t *testing.T) {
+	// the first block gives four values, the fifth starts the block for counter 1
+	want := []uint64{
+		8961650061795327875,
+		8932456490928670782,
+		3511794959974728230,
+		17393016308116685017,
+		3526525963387671265,
+		2709863685987507919,
+	}
+
+	stream := &seedStream{serverSeed: vectorServerSeed, clientSeed: vectorClientSeed}
+	for i, w := range want {
+		if got := stream.next(); got != w {
+			t.Errorf("value %d = %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestFairShuffle(t *testing.T) {
+	tests := []struct {
+		name       string
+		names      []string
+		serverSeed string
+		clientSeed string
+		want       []string
+	}{
+		{
+			name:       "ten names",
+			names:      vectorNames,
+			serverSeed: vectorServerSeed,
+			clientSeed: vectorClientSeed,
+			want:       []string{"Ivan", "Heidi", "Dave", "Carol", "Erin", "Bob", "Judy", "Grace", "Alice", "Frank"},
+		},
+		{
+			name:       "empty client seed",
+			names:      vectorNames,
+			serverSeed: vectorServerSeed,
+			clientSeed: "",
+			want:       []string{"Alice", "Bob", "Judy", "Dave", "Carol", "Grace", "Erin", "Ivan", "Heidi", "Frank"},
+		},
+		{
+			name:       "two names",
+			names:      []string{"x", "y"},
+			serverSeed: "a",
+			clientSeed: "b",
+			want:       []string{"y", "x"},
+		},
+		{
+			name:       "one name",
+			names:      []string{"x"},
+			serverSeed: vectorServerSeed,
+			clientSeed: vectorClientSeed,
+			want:       []string{"x"},
+		},
+		{
+			name:       "no names",
+			names:      []string{},
+			serverSeed: vectorServerSeed,
+			clientSeed: vectorClientSeed,
+			want:       []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.names)
+
+			got := fairShuffle(tt.names, tt.serverSeed, tt.clientSeed)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("fairShuffle() = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(tt.names, input) {
+				t.Errorf("fairShuffle() changed its input to %v", tt.names)
+			}
+		})
+	}
+}
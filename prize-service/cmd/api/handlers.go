@@ -2,15 +2,13 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"log"
-	"math/rand"
+	"math"
 	"net/http"
 	"prize-service/data"
-	"time"
 
-	"github.com/google/uuid"
+	"github.com/go-chi/chi"
+	"github.com/redis/go-redis/v9"
 )
 
 type Prizes struct {
@@ -22,25 +20,16 @@ func (app *Config) NewPrizes(w http.ResponseWriter, r *http.Request) {
 
 	ctx := context.Background()
 
-	var reqestPayload struct {
-		Names []string `json:"names"`
-	}
+	var reqestPayload NewDrawRequest
 
 	err := app.readJson(w, r, &reqestPayload)
 	if err != nil {
 		app.errorJson(w, err)
 		return
 	}
+	reqestPayload.Owner = authUser(r)
 
-	names := reqestPayload.Names
-
-	// make Names to a random slice
-	rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
-
-	// add to list with randomize names & drawId
-	uId := uuid.New()
-	drawId := fmt.Sprintf("draw:%s", uId)
-	err = app.Rdb.LPush(ctx, drawId, names).Err()
+	created, err := app.createDraw(ctx, reqestPayload)
 	if err != nil {
 		app.errorJson(w, err)
 		return
@@ -49,11 +38,7 @@ func (app *Config) NewPrizes(w http.ResponseWriter, r *http.Request) {
 	payload := JsonResponse{
 		Status:  "200",
 		Message: "",
-		Data: struct {
-			ID uuid.UUID `json:"id"`
-		}{
-			ID: uId,
-		},
+		Data:    created,
 	}
 
 	app.writeJson(w, http.StatusOK, payload)
@@ -65,7 +50,8 @@ func (app *Config) DrawPrizes(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 
 	var reqestPayload struct {
-		UId string `json:"uId"`
+		UId   string `json:"uId"`
+		Count int    `json:"count"`
 	}
 
 	err := app.readJson(w, r, &reqestPayload)
@@ -74,9 +60,37 @@ func (app *Config) DrawPrizes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	drawId := fmt.Sprintf("draw:%s", reqestPayload.UId)
+	count := reqestPayload.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > maxDrawCount {
+		app.errorJson(w, errorf(CodeBadRequest, "count must be between 1 and %d", maxDrawCount))
+		return
+	}
+
+	err = app.checkDrawAccess(ctx, r, reqestPayload.UId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// rounds of a plan are drawn in order, a plain draw would take their winners
+	planned, err := app.hasPlan(ctx, reqestPayload.UId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	if planned {
+		app.errorJson(w, errPlanned)
+		return
+	}
 
-	prize, err := app.Rdb.RPop(ctx, drawId).Result()
+	winners, warning, err := app.runDraw(ctx, DrawRun{
+		UId:       reqestPayload.UId,
+		Count:     count,
+		Requester: authUser(r),
+	})
 	if err != nil {
 		app.errorJson(w, err)
 		return
@@ -84,11 +98,13 @@ func (app *Config) DrawPrizes(w http.ResponseWriter, r *http.Request) {
 
 	payload := JsonResponse{
 		Status:  "200",
-		Message: "",
+		Message: warning,
 		Data: struct {
-			Name string `json:"name"`
+			Name  string   `json:"name"`
+			Names []string `json:"names"`
 		}{
-			Name: prize,
+			Name:  winners[0],
+			Names: winners,
 		},
 	}
 
@@ -99,8 +115,10 @@ func (app *Config) UpdatePrized(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 
 	var reqestPayload struct {
-		UId   string   `json:"uId"`
-		Names []string `json:"names"`
+		UId        string      `json:"uId"`
+		Names      []string    `json:"names"`
+		Entries    []DrawEntry `json:"entries"`
+		IgnoreCase bool        `json:"ignoreCase"`
 	}
 
 	err := app.readJson(w, r, &reqestPayload)
@@ -109,21 +127,95 @@ func (app *Config) UpdatePrized(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	names := reqestPayload.Names
+	if len(reqestPayload.Entries) > 0 {
+		reqestPayload.Entries, err = validateEntries(reqestPayload.Entries, reqestPayload.IgnoreCase)
+	} else {
+		reqestPayload.Names, err = validateNames(reqestPayload.Names, reqestPayload.IgnoreCase)
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
 
-	// make Names to a random slice
-	rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+	err = app.checkDrawAccess(ctx, r, reqestPayload.UId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
 
-	// add to list with randomize names & drawId
-	drawId := fmt.Sprintf("draw:%s", reqestPayload.UId)
-	app.Rdb.Del(ctx, drawId)
+	meta, err := app.drawMeta(ctx, reqestPayload.UId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	if meta.Status == drawStatusClosed {
+		app.errorJson(w, errDrawClosed)
+		return
+	}
 
-	err = app.Rdb.LPush(ctx, drawId, names).Err()
+	if len(reqestPayload.Entries) > 0 {
+		seed, err := app.fairSeed(ctx, reqestPayload.UId)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		if seed != nil {
+			app.errorJson(w, errFairNamesOnly)
+			return
+		}
+
+		err = app.saveEntries(ctx, reqestPayload.UId, reqestPayload.Entries)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	} else {
+		// make Names to a random slice
+		uId := reqestPayload.UId
+		names, err := app.shuffleNames(ctx, uId, reqestPayload.Names)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+
+		// add to list with randomize names & drawId
+		_, err = app.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, drawKey(uId), weightsKey(uId), stockKey(uId), groupsKey(uId))
+			pipe.LPush(ctx, drawKey(uId), names)
+			return nil
+		})
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	err = app.expireDraw(ctx, meta.ID, meta.ExpiresAt)
 	if err != nil {
 		app.errorJson(w, err)
 		return
 	}
 
+	// new entries put an exhausted draw back in play
+	if meta.Status == drawStatusExhausted {
+		err = app.setDrawStatus(ctx, meta.ID, drawStatusOpen)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	remaining, err := app.remaining(ctx, meta.ID)
+	if err != nil {
+		log.Println("Error counting remaining entries", err)
+	}
+
+	app.publishDrawEvent(ctx, DrawEvent{
+		Type:      drawEventUpdate,
+		DrawID:    meta.ID,
+		Remaining: remaining,
+	})
+
 	payload := JsonResponse{
 		Status:  "200",
 		Message: "",
@@ -134,106 +226,132 @@ func (app *Config) UpdatePrized(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (app *Config) HandleNotFound(w http.ResponseWriter, r *http.Request) {
-	res := JsonResponse{
-		Status:  "9999",
-		Message: "route not found",
-		Data:    struct{}{},
+func (app *Config) DrawHistory(w http.ResponseWriter, r *http.Request) {
+	uId := chi.URLParam(r, "id")
+
+	history, err := app.drawHistory(context.Background(), uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data: struct {
+			ID      string                   `json:"id"`
+			History []*data.DrawHistoryEntry `json:"history"`
+		}{
+			ID:      uId,
+			History: history,
+		},
 	}
-	app.writeJson(w, http.StatusNotFound, res)
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) HandleNotFound(w http.ResponseWriter, r *http.Request) {
+	app.errorJson(w, newError(CodeNotFound, "route not found"))
 }
 
 func (app *Config) DrawRestaurants(w http.ResponseWriter, r *http.Request) {
 	log.Println("draw restaurant")
 	ctx := context.Background()
-	redisKey := "restaurants"
 
-	// Check if there is data in Redis
-	exists, err := app.Rdb.Exists(ctx, redisKey).Result()
+	var requestPayload RestaurantDrawRequest
+
+	// an empty body keeps the old behaviour of three picks from the whole catalog
+	if r.ContentLength != 0 {
+		err := app.readJson(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	err := requestPayload.validate()
 	if err != nil {
 		app.errorJson(w, err)
 		return
 	}
 
-	log.Println("exists", exists)
+	team, err := app.restaurantTeam(r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
 
-	var restaurants []*data.RestaurantEntry
+	// the winners of finished polls have to sit out this draw
+	err = app.closeExpiredPolls(ctx, team)
+	if err != nil {
+		log.Println("Error closing expired polls", err)
+	}
 
-	if exists == 0 {
-		// No data in Redis - get restaurants from database
-		restaurantData, err := app.Models.RestaurantEntry.All()
+	recent, err := app.recentRestaurants(ctx, team)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// mongo does the filtering and the picking, only the drawn places come back
+	filter := requestPayload.filter(recent)
+	drawn, err := app.Models.RestaurantEntry.Sample(filter, requestPayload.Count)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if len(drawn) == 0 {
+		filter.Exclude = nil
+		matching, err := app.Models.RestaurantEntry.Count(filter)
 		if err != nil {
 			app.errorJson(w, err)
 			return
 		}
+		if matching > 0 {
+			app.errorJson(w, errorf(CodeNotFound, "all %d matching restaurants were drawn recently, try again later or widen the filter", matching))
+			return
+		}
+		if requestPayload.nearby() {
+			app.errorJson(w, newError(CodeNotFound, "no restaurants within the radius match the filter"))
+			return
+		}
+		app.errorJson(w, newError(CodeNotFound, "no restaurants match the filter"))
+		return
+	}
 
-		restaurants = restaurantData
-
-		if len(restaurants) > 0 {
-			restaurantBytes, err := json.Marshal(restaurants)
-			if err != nil {
-				app.errorJson(w, err)
-				return
-			}
-
-			// Put restaurants JSON in Redis for future use
-			err = app.Rdb.Set(ctx, redisKey, restaurantBytes, time.Hour).Err()
-			if err != nil {
-				app.errorJson(w, err)
-				return
-			}
+	responseRestaurants := make([]RestaurantRes, 0, len(drawn))
+	for _, restaurant := range drawn {
+		res := restaurantRes(&restaurant.RestaurantEntry)
+		if requestPayload.nearby() {
+			distance := math.Round(restaurant.Distance)
+			res.Distance = &distance
 		}
-	} else {
-		// Get restaurants from Redis
-		restaurantData, err := app.Rdb.Get(ctx, redisKey).Result()
-		if err != nil {
-			app.errorJson(w, err)
+		responseRestaurants = append(responseRestaurants, res)
+	}
+
+	var poll *RestaurantPoll
+	if requestPayload.Poll {
+		if len(responseRestaurants) < 2 {
+			app.errorJson(w, errorf(CodeNotEnoughEntries, "a poll needs at least 2 restaurants, only %d matched", len(responseRestaurants)))
 			return
 		}
-		// Unmarshal JSON data back to restaurant objects
-		err = json.Unmarshal([]byte(restaurantData), &restaurants)
+
+		poll, err = app.createPoll(ctx, team, responseRestaurants, *requestPayload.PollDeadline)
 		if err != nil {
 			app.errorJson(w, err)
 			return
 		}
 	}
 
-	if len(restaurants) == 0 {
-		app.errorJson(w, fmt.Errorf("no restaurants available"))
-		return
+	ids := make([]string, 0, len(responseRestaurants))
+	for _, restaurant := range responseRestaurants {
+		ids = append(ids, restaurant.key())
 	}
 
-	// Shuffle the restaurants
-	rand.Shuffle(len(restaurants), func(i, j int) {
-		restaurants[i], restaurants[j] = restaurants[j], restaurants[i]
-	})
-
-	// Select up to 3 restaurants
-	maxSelect := 3
-	if len(restaurants) < maxSelect {
-		maxSelect = len(restaurants)
-	}
-	selectedRestaurants := restaurants[:maxSelect]
-
-	type RestaurantRes struct {
-		ID      string  `json:"id"`
-		Name    string  `json:"name"`
-		Address string  `json:"address"`
-		Rating  float64 `json:"rating"`
-		PlaceID string  `json:"placeId"`
-		Area    string  `json:"area"`
-	}
-
-	var responseRestaurants []RestaurantRes
-	for _, restaurant := range selectedRestaurants {
-		responseRestaurants = append(responseRestaurants, RestaurantRes{
-			ID:      restaurant.ID.Hex(),
-			Name:    restaurant.Name,
-			Address: restaurant.Address,
-			Rating:  restaurant.Rating,
-			PlaceID: restaurant.PlaceID,
-			Area:    restaurant.Area,
-		})
+	err = app.rememberRestaurants(ctx, team, ids)
+	if err != nil {
+		log.Println("Error remembering drawn restaurants", err)
 	}
 
 	// Return response
@@ -242,8 +360,10 @@ func (app *Config) DrawRestaurants(w http.ResponseWriter, r *http.Request) {
 		Message: "",
 		Data: struct {
 			Restaurants []RestaurantRes `json:"restaurants"`
+			Poll        *RestaurantPoll `json:"poll,omitempty"`
 		}{
 			Restaurants: responseRestaurants,
+			Poll:        poll,
 		},
 	}
 
@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
+	"net"
 	"net/http"
 )
 
 type JsonResponse struct {
 	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
 	Data    any    `json:"data,omitempty"`
 }
@@ -21,12 +24,12 @@ func (app *Config) readJson(w http.ResponseWriter, r *http.Request, data any) er
 	dec := json.NewDecoder(r.Body)
 	err := dec.Decode(data)
 	if err != nil {
-		return err
+		return wrapError(CodeBadRequest, err)
 	}
 
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must only have a single json value")
+		return newError(CodeBadRequest, "body must only have a single json value")
 	}
 	return nil
 
@@ -54,17 +57,33 @@ func (app *Config) writeJson(w http.ResponseWriter, status int, data any, header
 	return nil
 }
 
-func (app *Config) errorJson(w http.ResponseWriter, err error, status ...int) error {
-	statusCode := http.StatusBadRequest
+func (app *Config) errorJson(w http.ResponseWriter, err error) error {
+	code := errorCode(err)
+	kind := errorKinds[code]
 
-	if len(status) > 0 {
-		statusCode = status[0]
+	if kind.httpStatus >= http.StatusInternalServerError {
+		log.Println("Error handling request", err)
 	}
 
 	var payload JsonResponse
 
-	payload.Status = "9999"
+	payload.Status = kind.status
+	payload.Code = string(code)
 	payload.Message = err.Error()
 
-	return app.writeJson(w, statusCode, payload)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		payload.Data = validationErr
+	}
+
+	return app.writeJson(w, kind.httpStatus, payload)
+}
+
+// requester identifies who made the request, RealIP has already replaced RemoteAddr when proxied
+func requester(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"prize-service/data"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// winners mongo did not take yet, they are already gone from the pool so redis
+// holds on to them until the next read of the history writes them through
+func pendingHistoryKey(uId string) string {
+	return fmt.Sprintf("draw:%s:history", uId)
+}
+
+// saveHistory records the winners in mongo and queues them in redis when that fails
+func (app *Config) saveHistory(ctx context.Context, meta *DrawMeta, history []data.DrawHistoryEntry) error {
+	err := app.Models.DrawHistoryEntry.InsertMany(history)
+	if err == nil {
+		return nil
+	}
+	log.Println("Error saving draw history, queueing it", err)
+
+	entries := make([]any, 0, len(history))
+	for _, entry := range history {
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, encoded)
+	}
+
+	_, err = app.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, pendingHistoryKey(meta.ID), entries...)
+		pipe.ExpireAt(ctx, pendingHistoryKey(meta.ID), meta.ExpiresAt.Add(drawRetention))
+		return nil
+	})
+	return err
+}
+
+const (
+	historyPendingWarning = "winners are drawn but not on record yet, saving them is retried in the background"
+	maxHistoryRetryWait   = 5 * time.Minute
+)
+
+// retryHistory keeps trying both stores for winners that neither took, it gives
+// up once the draw is past its retention
+func (app *Config) retryHistory(meta DrawMeta, history []data.DrawHistoryEntry) {
+	wait := time.Second
+	for time.Now().Before(meta.ExpiresAt.Add(drawRetention)) {
+		time.Sleep(wait)
+
+		err := app.saveHistory(context.Background(), &meta, history)
+		if err == nil {
+			log.Println("Saved draw history of", meta.ID, "after retrying")
+			return
+		}
+
+		wait = min(wait*2, maxHistoryRetryWait)
+	}
+	log.Println("Gave up saving draw history", meta.ID, history)
+}
+
+// flushHistory writes queued winners through to mongo, they go back in the
+// queue when mongo is still unavailable
+func (app *Config) flushHistory(ctx context.Context, uId string) error {
+	key := pendingHistoryKey(uId)
+
+	var pending *redis.StringSliceCmd
+	var ttl *redis.DurationCmd
+	_, err := app.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pending = pipe.LRange(ctx, key, 0, -1)
+		ttl = pipe.PTTL(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(pending.Val()) == 0 {
+		return nil
+	}
+
+	history := make([]data.DrawHistoryEntry, 0, len(pending.Val()))
+	for _, raw := range pending.Val() {
+		var entry data.DrawHistoryEntry
+		err = json.Unmarshal([]byte(raw), &entry)
+		if err != nil {
+			return err
+		}
+		history = append(history, entry)
+	}
+
+	err = app.Models.DrawHistoryEntry.InsertMany(history)
+	if err == nil {
+		return nil
+	}
+
+	// pushed to the front backwards, so they stay ahead of winners queued meanwhile
+	requeue := make([]any, 0, len(pending.Val()))
+	for i := len(pending.Val()) - 1; i >= 0; i-- {
+		requeue = append(requeue, pending.Val()[i])
+	}
+	_, requeueErr := app.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, requeue...)
+		if ttl.Val() > 0 {
+			pipe.PExpire(ctx, key, ttl.Val())
+		}
+		return nil
+	})
+	if requeueErr != nil {
+		log.Println("Error requeueing draw history", requeueErr, history)
+	}
+	return err
+}
+
+// drawHistory is the full history of a draw, queued winners included
+func (app *Config) drawHistory(ctx context.Context, uId string) ([]*data.DrawHistoryEntry, error) {
+	err := app.flushHistory(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+	return app.Models.DrawHistoryEntry.AllByDraw(uId)
+}
+
+// lastWinner is the latest winner that was not forfeited, queued winners included
+func (app *Config) lastWinner(ctx context.Context, uId string) (*data.DrawHistoryEntry, error) {
+	err := app.flushHistory(ctx, uId)
+	if err != nil {
+		return nil, err
+	}
+	return app.Models.DrawHistoryEntry.LastByDraw(uId)
+}
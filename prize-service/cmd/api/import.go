@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	maxUploadBytes = 10 << 20 // ten megabytes
+
+	// a few kilobytes of zip can unpack to gigabytes, xlsx uploads may grow this far
+	maxUnzipBytes = 100 << 20
+	// sheets larger than this are unpacked to a temp file instead of memory
+	maxUnzipXMLBytes = 16 << 20
+)
+
+type RejectedLine struct {
+	Line   int    `json:"line"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+type ImportSummary struct {
+	Rows     int            `json:"rows"`
+	Accepted int            `json:"accepted"`
+	Weighted bool           `json:"weighted"`
+	Entries  []DrawEntry    `json:"entries"`
+	Rejected []RejectedLine `json:"rejected"`
+}
+
+type columnMapping struct {
+	name   string
+	weight string
+	group  string
+}
+
+// readRows returns every row of the upload, xlsx files are read from their first sheet
+func readRows(file io.Reader, filename string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		// excel saves utf-8 csv files with a byte order mark
+		if len(rows) > 0 && len(rows[0]) > 0 {
+			rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+		}
+		return rows, nil
+	case ".xlsx":
+		book, err := excelize.OpenReader(file, excelize.Options{
+			UnzipSizeLimit:    maxUnzipBytes,
+			UnzipXMLSizeLimit: maxUnzipXMLBytes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer book.Close()
+
+		sheets := book.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("workbook has no sheets")
+		}
+		return book.GetRows(sheets[0])
+	}
+	return nil, errors.New("only .csv and .xlsx files are supported")
+}
+
+func columnIndex(header []string, column string) int {
+	for i, title := range header {
+		if strings.EqualFold(strings.TrimSpace(title), column) {
+			return i
+		}
+	}
+	return -1
+}
+
+func cell(row []string, index int) string {
+	if index < 0 || index >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[index])
+}
+
+// parseRows maps the columns of every row to an entry, the first row is the header
+func parseRows(rows [][]string, mapping columnMapping, ignoreCase bool) (*ImportSummary, error) {
+	if len(rows) == 0 {
+		return nil, newError(CodeBadRequest, "file is empty")
+	}
+
+	header := rows[0]
+	nameIndex := columnIndex(header, mapping.name)
+	if nameIndex < 0 {
+		return nil, errorf(CodeBadRequest, "name column %q not found in header", mapping.name)
+	}
+	weightIndex := columnIndex(header, mapping.weight)
+	groupIndex := columnIndex(header, mapping.group)
+
+	summary := &ImportSummary{
+		Rows:     len(rows) - 1,
+		Weighted: weightIndex >= 0,
+		Entries:  []DrawEntry{},
+		Rejected: []RejectedLine{},
+	}
+
+	if err := checkEntryCount(summary.Rows); err != nil {
+		return nil, err
+	}
+
+	checker := newEntryChecker(ignoreCase)
+	checker.label = "line"
+
+	for i, row := range rows[1:] {
+		line := i + 2
+		raw := cell(row, nameIndex)
+
+		entry := DrawEntry{Weight: 1, Quantity: 1, Group: cell(row, groupIndex)}
+
+		if weight := cell(row, weightIndex); weight != "" {
+			value, err := strconv.Atoi(weight)
+			if err != nil || value < 1 {
+				summary.Rejected = append(summary.Rejected, RejectedLine{Line: line, Value: raw, Reason: fmt.Sprintf("invalid weight %q", weight)})
+				continue
+			}
+			entry.Weight = value
+		}
+
+		name, ok := checker.check(line, raw)
+		if !ok {
+			rejected := checker.rejected[len(checker.rejected)-1]
+			summary.Rejected = append(summary.Rejected, RejectedLine{Line: line, Value: raw, Reason: rejected.Reason})
+			continue
+		}
+		entry.Name = name
+
+		summary.Entries = append(summary.Entries, entry)
+	}
+
+	summary.Accepted = len(summary.Entries)
+	return summary, nil
+}
+
+func (app *Config) ImportDraw(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	err := r.ParseMultipartForm(maxUploadBytes)
+	if err != nil {
+		app.errorJson(w, wrapError(CodeBadRequest, err))
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.errorJson(w, wrapError(CodeBadRequest, err))
+		return
+	}
+	defer file.Close()
+
+	rows, err := readRows(file, header.Filename)
+	if err != nil {
+		app.errorJson(w, wrapError(CodeBadRequest, err))
+		return
+	}
+
+	mapping := columnMapping{
+		name:   formValue(r, "nameColumn", "name"),
+		weight: formValue(r, "weightColumn", "weight"),
+		group:  formValue(r, "groupColumn", "group"),
+	}
+	ignoreCase := r.FormValue("ignoreCase") == "true"
+
+	summary, err := parseRows(rows, mapping, ignoreCase)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// a preview only reports what would be imported
+	if r.FormValue("preview") == "true" {
+		payload := JsonResponse{
+			Status:  "200",
+			Message: "",
+			Data: struct {
+				Summary *ImportSummary `json:"summary"`
+			}{
+				Summary: summary,
+			},
+		}
+
+		app.writeJson(w, http.StatusOK, payload)
+		return
+	}
+
+	req := NewDrawRequest{
+		Title:      r.FormValue("title"),
+		Owner:      authUser(r),
+		IgnoreCase: ignoreCase,
+		groups:     map[string]string{},
+
+		Event:          r.FormValue("event"),
+		ExcludeWinners: r.FormValue("excludeWinners") == "true",
+	}
+	if expiresAt := r.FormValue("expiresAt"); expiresAt != "" {
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			app.errorJson(w, wrapError(CodeBadRequest, err))
+			return
+		}
+		req.ExpiresAt = &t
+	}
+
+	if summary.Weighted {
+		req.Entries = summary.Entries
+	} else {
+		for _, entry := range summary.Entries {
+			req.Names = append(req.Names, entry.Name)
+			if entry.Group != "" {
+				req.groups[entry.Name] = entry.Group
+			}
+		}
+	}
+
+	created, err := app.createDraw(ctx, req)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data: struct {
+			*CreatedDraw
+			Summary *ImportSummary `json:"summary"`
+		}{
+			CreatedDraw: created,
+			Summary:     summary,
+		},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func formValue(r *http.Request, key, fallback string) string {
+	if value := strings.TrimSpace(r.FormValue(key)); value != "" {
+		return value
+	}
+	return fallback
+}
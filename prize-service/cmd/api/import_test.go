@@ -0,0 +1,127 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRows(t *testing.T) {
+	mapping := columnMapping{name: "name", weight: "weight", group: "group"}
+
+	tests := []struct {
+		name         string
+		rows         [][]string
+		ignoreCase   bool
+		want         []DrawEntry
+		wantWeighted bool
+		wantRejected []RejectedLine
+		wantErr      string
+	}{
+		{
+			name: "names only",
+			rows: [][]string{
+				{"Name", "Email"},
+				{" Alice ", "alice@example.com"},
+				{"Bob", "bob@example.com"},
+			},
+			want: []DrawEntry{
+				{Name: "Alice", Weight: 1, Quantity: 1},
+				{Name: "Bob", Weight: 1, Quantity: 1},
+			},
+		},
+		{
+			name: "weight and group columns",
+			rows: [][]string{
+				{"group", "NAME", "Weight"},
+				{"sales", "Alice", "3"},
+				{"", "Bob", ""},
+			},
+			want: []DrawEntry{
+				{Name: "Alice", Weight: 3, Quantity: 1, Group: "sales"},
+				{Name: "Bob", Weight: 1, Quantity: 1},
+			},
+			wantWeighted: true,
+		},
+		{
+			name: "invalid weights",
+			rows: [][]string{
+				{"name", "weight"},
+				{"Alice", "many"},
+				{"Bob", "-2"},
+				{"Carol", "0"},
+			},
+			want:         []DrawEntry{},
+			wantWeighted: true,
+			wantRejected: []RejectedLine{
+				{Line: 2, Value: "Alice", Reason: `invalid weight "many"`},
+				{Line: 3, Value: "Bob", Reason: `invalid weight "-2"`},
+				{Line: 4, Value: "Carol", Reason: `invalid weight "0"`},
+			},
+		},
+		{
+			name: "duplicates and short rows",
+			rows: [][]string{
+				{"email", "name"},
+				{"a@example.com", "Alice"},
+				{"b@example.com"},
+				{"c@example.com", "alice"},
+				{"d@example.com", "Alice"},
+			},
+			ignoreCase: true,
+			want:       []DrawEntry{{Name: "Alice", Weight: 1, Quantity: 1}},
+			wantRejected: []RejectedLine{
+				{Line: 3, Value: "", Reason: "empty name"},
+				{Line: 4, Value: "alice", Reason: "duplicate of line 2"},
+				{Line: 5, Value: "Alice", Reason: "duplicate of line 2"},
+			},
+		},
+		{
+			name:    "empty file",
+			rows:    [][]string{},
+			wantErr: "file is empty",
+		},
+		{
+			name:    "no name column",
+			rows:    [][]string{{"email"}, {"a@example.com"}},
+			wantErr: `name column "name" not found in header`,
+		},
+		{
+			name:    "header only",
+			rows:    [][]string{{"name"}},
+			wantErr: "at least one entry is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := parseRows(tt.rows, mapping, tt.ignoreCase)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(summary.Entries, tt.want) {
+				t.Errorf("entries = %+v, want %+v", summary.Entries, tt.want)
+			}
+			if summary.Weighted != tt.wantWeighted {
+				t.Errorf("weighted = %v, want %v", summary.Weighted, tt.wantWeighted)
+			}
+			if tt.wantRejected == nil {
+				tt.wantRejected = []RejectedLine{}
+			}
+			if !slices.Equal(summary.Rejected, tt.wantRejected) {
+				t.Errorf("rejected = %+v, want %+v", summary.Rejected, tt.wantRejected)
+			}
+			if summary.Rows != len(tt.rows)-1 || summary.Accepted != len(tt.want) {
+				t.Errorf("rows = %d accepted = %d, want %d and %d", summary.Rows, summary.Accepted, len(tt.rows)-1, len(tt.want))
+			}
+		})
+	}
+}
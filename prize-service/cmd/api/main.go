@@ -5,26 +5,47 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
 	"prize-service/data"
+	"syscall"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-const (
-	webPort = "80"
-)
+const disconnectTimeout = 10 * time.Second
 
 type Config struct {
-	Rdb    *redis.Client
-	Models data.Models
+	Rdb            *redis.Client
+	Models         data.Models
+	IdempotencyTTL time.Duration
+	JWTSecret      []byte
+	APIKeys        map[string]string
+	AdminUsers     map[string]bool
+	// members of each team, only they can draw restaurants for it
+	Teams          map[string]map[string]bool
+	RateLimits     map[string]RateLimit
+	Spec           *OpenAPISpec
+	AllowedOrigins []string
+	TrustedProxies []netip.Prefix
+	// how long a drawn restaurant is skipped for the same team
+	RestaurantCooldown time.Duration
+	// closed when the server starts shutting down so event streams let go
+	shutdown chan struct{}
 }
 
 func main() {
 	log.Println("prize-service init")
 
+	serverConfig, err := loadServerConfig()
+	if err != nil {
+		log.Panic(err)
+	}
+
 	redisClient, err := connectToRedis()
 	if err != nil {
 		log.Panic(err)
@@ -35,22 +56,137 @@ func main() {
 		log.Panic(err)
 	}
 
+	models := data.New(mongoClient)
+
+	// location draws need the index, everything else still works without it
+	err = models.RestaurantEntry.EnsureGeoIndex()
+	if err != nil {
+		log.Println("restaurants cannot be drawn by location until the geo index exists")
+	}
+
+	idempotencyTTL := defaultIdempotencyTTL
+	if ttl := os.Getenv("IDEMPOTENCY_TTL"); ttl != "" {
+		idempotencyTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	restaurantCooldown := defaultRestaurantCooldown
+	if cooldown := os.Getenv("RESTAURANT_COOLDOWN"); cooldown != "" {
+		restaurantCooldown, err = time.ParseDuration(cooldown)
+		if err != nil || restaurantCooldown <= 0 {
+			log.Panic("RESTAURANT_COOLDOWN must be a positive duration: ", cooldown)
+		}
+	}
+
+	apiKeys, err := parseAPIKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	adminUsers := parseAdminUsers(os.Getenv("ADMIN_USERS"))
+	if len(adminUsers) == 0 {
+		log.Println("ADMIN_USERS is not set, nobody can change the restaurant catalog or manage draws without an owner")
+	}
+
+	teams, err := parseTeams(os.Getenv("TEAMS"))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" && len(apiKeys) == 0 {
+		log.Println("neither JWT_SECRET nor API_KEYS is set, draws cannot be created")
+	}
+
+	if len(serverConfig.TrustedProxies) == 0 {
+		log.Println("TRUSTED_PROXIES is not set, anonymous clients are told apart by the connecting address only")
+	}
+
+	rateLimits, err := parseRateLimits(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	spec, err := loadSpec()
+	if err != nil {
+		log.Panic(err)
+	}
+
 	app := Config{
-		Rdb:    redisClient,
-		Models: data.New(mongoClient),
+		Rdb:                redisClient,
+		Models:             models,
+		IdempotencyTTL:     idempotencyTTL,
+		JWTSecret:          []byte(jwtSecret),
+		APIKeys:            apiKeys,
+		AdminUsers:         adminUsers,
+		Teams:              teams,
+		RateLimits:         rateLimits,
+		Spec:               spec,
+		AllowedOrigins:     serverConfig.AllowedOrigins,
+		TrustedProxies:     serverConfig.TrustedProxies,
+		RestaurantCooldown: restaurantCooldown,
+		shutdown:           make(chan struct{}),
 	}
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", webPort),
-		Handler: app.routes(),
+		Addr:              fmt.Sprintf(":%s", serverConfig.Port),
+		Handler:           app.routes(),
+		ReadHeaderTimeout: serverConfig.ReadTimeout,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
+	}
+	// Shutdown does not wait for hijacked websockets or streams, they are told to stop here
+	srv.RegisterOnShutdown(func() {
+		close(app.shutdown)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("listening on port %s", serverConfig.Port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
+		log.Panic(err)
+	case <-ctx.Done():
+		stop()
 	}
 
-	err = srv.ListenAndServe()
+	log.Println("shutting down, waiting for in-flight requests")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout)
+	defer cancel()
 
+	err = srv.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Panic(err)
+		log.Println("Error shutting down server", err)
+	}
+
+	disconnect(redisClient, mongoClient)
+
+	log.Println("prize-service stopped")
+}
+
+func disconnect(rdb *redis.Client, mc *mongo.Client) {
+	err := rdb.Close()
+	if err != nil {
+		log.Println("Error closing redis", err)
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+
+	err = mc.Disconnect(ctx)
+	if err != nil {
+		log.Println("Error disconnecting mongo", err)
+	}
 }
 
 func connectToRedis() (*redis.Client, error) {
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	drawStatusOpen      = "open"
+	drawStatusClosed    = "closed"
+	drawStatusExhausted = "exhausted"
+
+	defaultDrawLifetime = 30 * 24 * time.Hour
+	// keys stay readable for a while after the draw expires
+	drawRetention = 7 * 24 * time.Hour
+)
+
+var (
+	errDrawNotFound  = newError(CodeDrawNotFound, "draw not found")
+	errDrawClosed    = newError(CodeDrawClosed, "draw is closed")
+	errDrawExhausted = newError(CodeDrawExhausted, "draw is exhausted")
+)
+
+type DrawMeta struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Owner     string    `json:"owner"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	Event          string `json:"event,omitempty"`
+	ExcludeWinners bool   `json:"excludeWinners,omitempty"`
+}
+
+func metaKey(uId string) string {
+	return fmt.Sprintf("draw:%s:meta", uId)
+}
+
+func drawKeys(uId string) []string {
+	return []string{drawKey(uId), weightsKey(uId), stockKey(uId), groupsKey(uId), fairKey(uId), planKey(uId), sharesKey(uId), shareLinkKey(uId), pendingHistoryKey(uId), metaKey(uId)}
+}
+
+func (app *Config) saveDrawMeta(ctx context.Context, meta DrawMeta) error {
+	err := app.Rdb.HSet(ctx, metaKey(meta.ID),
+		"title", meta.Title,
+		"owner", meta.Owner,
+		"status", meta.Status,
+		"created_at", meta.CreatedAt.Format(time.RFC3339),
+		"expires_at", meta.ExpiresAt.Format(time.RFC3339),
+		"event", meta.Event,
+		"exclude_winners", strconv.FormatBool(meta.ExcludeWinners),
+	).Err()
+	if err != nil {
+		return err
+	}
+
+	return app.expireDraw(ctx, meta.ID, meta.ExpiresAt)
+}
+
+// expireDraw has to run again after the list is re-pushed, redis drops the ttl with the key
+func (app *Config) expireDraw(ctx context.Context, uId string, expiresAt time.Time) error {
+	pipe := app.Rdb.Pipeline()
+	for _, key := range drawKeys(uId) {
+		pipe.ExpireAt(ctx, key, expiresAt.Add(drawRetention))
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (app *Config) setDrawStatus(ctx context.Context, uId, status string) error {
+	return app.Rdb.HSet(ctx, metaKey(uId), "status", status).Err()
+}
+
+// drawMeta loads the metadata and closes draws that are past their expiry
+func (app *Config) drawMeta(ctx context.Context, uId string) (*DrawMeta, error) {
+	fields, err := app.Rdb.HGetAll(ctx, metaKey(uId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return app.adoptLegacyDraw(ctx, uId)
+	}
+
+	meta := DrawMeta{
+		ID:     uId,
+		Title:  fields["title"],
+		Owner:  fields["owner"],
+		Status: fields["status"],
+		Event:  fields["event"],
+	}
+	meta.ExcludeWinners, _ = strconv.ParseBool(fields["exclude_winners"])
+	meta.CreatedAt, _ = time.Parse(time.RFC3339, fields["created_at"])
+	meta.ExpiresAt, _ = time.Parse(time.RFC3339, fields["expires_at"])
+
+	if meta.Status == drawStatusOpen && time.Now().After(meta.ExpiresAt) {
+		meta.Status = drawStatusClosed
+		err = app.setDrawStatus(ctx, uId, drawStatusClosed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &meta, nil
+}
+
+// adoptLegacyDraw gives a draw created before metadata existed an open status and
+// no owner, which leaves it to the admins until they share it. its lifetime starts now
+func (app *Config) adoptLegacyDraw(ctx context.Context, uId string) (*DrawMeta, error) {
+	exists, err := app.Rdb.Exists(ctx, drawKey(uId), stockKey(uId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, errDrawNotFound
+	}
+
+	meta := DrawMeta{
+		ID:        uId,
+		Status:    drawStatusOpen,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(defaultDrawLifetime),
+	}
+
+	err = app.saveDrawMeta(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (app *Config) GetDraw(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	meta, err := app.drawMeta(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	remaining, err := app.remaining(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	seed, err := app.fairSeed(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	seedHash := ""
+	if seed != nil {
+		seedHash = seed.SeedHash
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data: struct {
+			*DrawMeta
+			Remaining int64  `json:"remaining"`
+			SeedHash  string `json:"seedHash,omitempty"`
+		}{
+			DrawMeta:  meta,
+			Remaining: remaining,
+			SeedHash:  seedHash,
+		},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) CloseDraw(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	meta, err := app.drawMeta(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if meta.Status == drawStatusOpen {
+		meta.Status = drawStatusClosed
+		err = app.setDrawStatus(ctx, uId, drawStatusClosed)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+
+		app.publishDrawEvent(ctx, DrawEvent{Type: drawEventClose, DrawID: uId})
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    meta,
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	// how long a retry waits on the first request before the key is freed again
+	idempotencyLockTTL = time.Minute
+)
+
+type idempotentResponse struct {
+	Pending     bool   `json:"pending"`
+	BodyHash    string `json:"bodyHash"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent replays the stored response when a request is retried with the same Idempotency-Key
+func (app *Config) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.Background()
+		// keys are scoped to the caller so users cannot replay each other's responses
+		redisKey := fmt.Sprintf("idempotency:%s:%s:%s:%s", authUser(r), r.Method, r.URL.Path, key)
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+		if err != nil {
+			app.errorJson(w, wrapError(CodeBadRequest, err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		bodyHash := hex.EncodeToString(sum[:])
+
+		pending, err := json.Marshal(idempotentResponse{Pending: true, BodyHash: bodyHash})
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+
+		acquired, err := app.Rdb.SetNX(ctx, redisKey, pending, idempotencyLockTTL).Result()
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+
+		if !acquired {
+			app.replayResponse(w, redisKey, bodyHash)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		// server errors are not cached so the retry gets a real second attempt
+		if rec.status >= http.StatusInternalServerError {
+			app.Rdb.Del(ctx, redisKey)
+			return
+		}
+
+		stored, err := json.Marshal(idempotentResponse{
+			BodyHash:    bodyHash,
+			Status:      rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+		})
+		if err != nil {
+			log.Println("Error encoding idempotent response", err)
+			return
+		}
+
+		ttl := app.IdempotencyTTL
+		if ttl == 0 {
+			ttl = defaultIdempotencyTTL
+		}
+
+		err = app.Rdb.Set(ctx, redisKey, stored, ttl).Err()
+		if err != nil {
+			log.Println("Error storing idempotent response", err)
+		}
+	})
+}
+
+func (app *Config) replayResponse(w http.ResponseWriter, redisKey, bodyHash string) {
+	raw, err := app.Rdb.Get(context.Background(), redisKey).Bytes()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	var stored idempotentResponse
+	err = json.Unmarshal(raw, &stored)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if stored.BodyHash != bodyHash {
+		app.errorJson(w, newError(CodeIdempotencyMismatch, "Idempotency-Key was already used with a different request body"))
+		return
+	}
+
+	if stored.Pending {
+		app.errorJson(w, newError(CodeConflict, "a request with this Idempotency-Key is still in progress"))
+		return
+	}
+
+	w.Header().Set("Content-Type", stored.ContentType)
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
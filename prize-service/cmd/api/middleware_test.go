@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotentReplay(t *testing.T) {
+	app, _ := newTestApp(t)
+
+	calls := 0
+	status := http.StatusOK
+	h := app.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d}`, calls)
+	}))
+
+	send := func(user, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/draw", strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", key)
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	first := send("alice", "k1", `{"uId":"d1"}`)
+	retry := send("alice", "k1", `{"uId":"d1"}`)
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want once", calls)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %s, want the first response %d %s", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("retry headers = %v, want the replay marker and the stored content type", retry.Header())
+	}
+
+	if w := send("alice", "k1", `{"uId":"d2"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key with another body = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	// keys belong to the caller, another user with the same key gets a response of their own
+	if send("bob", "k1", `{"uId":"d1"}`); calls != 2 {
+		t.Errorf("handler ran %d times after another user reused the key, want twice", calls)
+	}
+
+	// server errors are not stored, the retry runs the handler again
+	status = http.StatusServiceUnavailable
+	send("alice", "k2", `{}`)
+	status = http.StatusOK
+	if w := send("alice", "k2", `{}`); calls != 4 || w.Code != http.StatusOK {
+		t.Errorf("retry after a server error = %d with %d calls, want a fresh 200 and 4 calls", w.Code, calls)
+	}
+}
+
+func TestIdempotentPending(t *testing.T) {
+	app, _ := newTestApp(t)
+
+	var retry *httptest.ResponseRecorder
+	var h http.Handler
+	h = app.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a retry arriving while the first request is still running
+		if retry == nil {
+			retry = httptest.NewRecorder()
+			again := httptest.NewRequest(http.MethodPost, "/api/v1/draw", strings.NewReader(`{}`))
+			again.Header.Set("Idempotency-Key", "k1")
+			h.ServeHTTP(retry, again)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/draw", strings.NewReader(`{}`))
+	r.Header.Set("Idempotency-Key", "k1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if retry.Code != http.StatusConflict {
+		t.Errorf("retry during the first request = %d, want %d", retry.Code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/go-chi/chi"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+type OpenAPISpec struct {
+	Doc    *openapi3.T
+	router routers.Router
+}
+
+func loadSpec() (*OpenAPISpec, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openAPIDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	err = doc.Validate(loader.Context)
+	if err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+
+	// the document has no servers, so paths are matched as they are written
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenAPISpec{Doc: doc, router: router}, nil
+}
+
+func (app *Config) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIDocument)
+}
+
+// validateRequest rejects requests that do not match the openapi document, routes
+// missing from it are left to the router
+func (app *Config) validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.Spec == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, pathParams, err := app.Spec.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// readJson never required a content type, keep accepting bodies sent without one
+		if r.Header.Get("Content-Type") == "" && r.ContentLength != 0 {
+			r.Header.Set("Content-Type", "application/json")
+		}
+
+		// uploads are checked by the importer, reading them twice is not worth it
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody: mediaType == "multipart/form-data",
+				// credentials are checked by authenticate
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+
+		err = openapi3filter.ValidateRequest(context.Background(), input)
+		if err != nil {
+			app.errorJson(w, newError(CodeValidationFailed, validationMessage(err)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validationMessage keeps the field and the reason, the schema dump kin-openapi
+// appends is not useful to clients
+func validationMessage(err error) string {
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		var reqErr *openapi3filter.RequestError
+		field := strings.Join(schemaErr.JSONPointer(), ".")
+		if errors.As(err, &reqErr) && reqErr.Parameter != nil {
+			field = reqErr.Parameter.Name
+		}
+		if field == "" {
+			return schemaErr.Reason
+		}
+		return fmt.Sprintf("%s: %s", field, schemaErr.Reason)
+	}
+
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Error()
+	}
+	return err.Error()
+}
+
+// checkSpecRoutes makes sure every route is documented and every documented
+// operation is routed
+func checkSpecRoutes(mux chi.Routes, doc *openapi3.T) error {
+	routed := map[string]bool{}
+	var missing []string
+
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(strings.ReplaceAll(route, "/*/", "/"), "/")
+		routed[method+" "+route] = true
+
+		item := doc.Paths.Value(route)
+		if item == nil || item.GetOperation(method) == nil {
+			missing = append(missing, fmt.Sprintf("%s %s is not in the openapi document", method, route))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			if !routed[method+" "+path] {
+				missing = append(missing, fmt.Sprintf("%s %s has no route", method, path))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return errors.New(strings.Join(missing, "; "))
+	}
+	return nil
+}
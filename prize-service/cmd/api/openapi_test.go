@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi"
+)
+
+func specWith(paths map[string][]string) *openapi3.T {
+	doc := &openapi3.T{Paths: openapi3.NewPaths()}
+	for path, methods := range paths {
+		item := &openapi3.PathItem{}
+		for _, method := range methods {
+			item.SetOperation(method, openapi3.NewOperation())
+		}
+		doc.Paths.Set(path, item)
+	}
+	return doc
+}
+
+func TestCheckSpecRoutes(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	mux := chi.NewRouter()
+	mux.Route("/api/v1", func(r chi.Router) {
+		r.Post("/draw", noop)
+		r.Route("/draws/{id}", func(r chi.Router) {
+			r.Get("/", noop)
+			r.Post("/close", noop)
+		})
+	})
+
+	tests := []struct {
+		name    string
+		paths   map[string][]string
+		wantErr []string
+	}{
+		{
+			name: "matching",
+			paths: map[string][]string{
+				"/api/v1/draw":             {"POST"},
+				"/api/v1/draws/{id}":       {"GET"},
+				"/api/v1/draws/{id}/close": {"POST"},
+			},
+		},
+		{
+			name: "route missing from the document",
+			paths: map[string][]string{
+				"/api/v1/draw":       {"POST"},
+				"/api/v1/draws/{id}": {"GET"},
+			},
+			wantErr: []string{"POST /api/v1/draws/{id}/close is not in the openapi document"},
+		},
+		{
+			name: "documented path without a route",
+			paths: map[string][]string{
+				"/api/v1/draw":             {"POST"},
+				"/api/v1/draws/{id}":       {"GET", "DELETE"},
+				"/api/v1/draws/{id}/close": {"POST"},
+				"/api/v1/prizes":           {"PATCH"},
+			},
+			wantErr: []string{
+				"DELETE /api/v1/draws/{id} has no route",
+				"PATCH /api/v1/prizes has no route",
+			},
+		},
+		{
+			name: "method mismatch",
+			paths: map[string][]string{
+				"/api/v1/draw":             {"GET"},
+				"/api/v1/draws/{id}":       {"GET"},
+				"/api/v1/draws/{id}/close": {"POST"},
+			},
+			wantErr: []string{
+				"GET /api/v1/draw has no route",
+				"POST /api/v1/draw is not in the openapi document",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSpecRoutes(mux, specWith(tt.paths))
+
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got, want := err.Error(), strings.Join(tt.wantErr, "; "); got != want {
+				t.Errorf("error = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// the embedded document has to describe every route the service serves
+func TestEmbeddedSpecMatchesRoutes(t *testing.T) {
+	spec, err := loadSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &Config{}
+	err = checkSpecRoutes(app.routes().(chi.Routes), spec.Doc)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	errPlanNotFound = newError(CodeNotFound, "draw has no plan")
+	errPlanStarted  = newError(CodeConflict, "plan cannot change after the first round")
+	errPlanComplete = newError(CodeConflict, "every round of the plan has been drawn")
+	errPlanned      = newError(CodeConflict, "draw has a plan, draw its next round instead")
+)
+
+// moves the cursor back to ARGV[1] only while it still points right after that
+// round, once someone claimed the next one it is theirs to hand back
+var releaseRoundScript = redis.NewScript(`
+if tonumber(redis.call('HGET', KEYS[1], 'next')) == tonumber(ARGV[1]) + 1 then
+	redis.call('HSET', KEYS[1], 'next', ARGV[1])
+	return 1
+end
+return 0
+`)
+
+type PlanRound struct {
+	Round   int      `json:"round"`
+	Prize   string   `json:"prize"`
+	Count   int      `json:"count"`
+	Winners []string `json:"winners"`
+}
+
+type DrawPlan struct {
+	Rounds []PlanRound `json:"rounds"`
+	// index of the round drawn next, equal to len(Rounds) once the plan is complete
+	Next     int  `json:"next"`
+	Complete bool `json:"complete"`
+}
+
+func planKey(uId string) string {
+	return fmt.Sprintf("draw:%s:plan", uId)
+}
+
+func winnersField(round int) string {
+	return fmt.Sprintf("winners:%d", round)
+}
+
+func (app *Config) drawPlan(ctx context.Context, uId string) (*DrawPlan, error) {
+	fields, err := app.Rdb.HGetAll(ctx, planKey(uId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errPlanNotFound
+	}
+
+	var plan DrawPlan
+	err = json.Unmarshal([]byte(fields["rounds"]), &plan.Rounds)
+	if err != nil {
+		return nil, err
+	}
+	plan.Next, _ = strconv.Atoi(fields["next"])
+	plan.Complete = plan.Next >= len(plan.Rounds)
+
+	for i := range plan.Rounds {
+		plan.Rounds[i].Winners = []string{}
+		if winners, ok := fields[winnersField(i)]; ok {
+			err = json.Unmarshal([]byte(winners), &plan.Rounds[i].Winners)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &plan, nil
+}
+
+// claimRound moves the plan cursor forward so two operators cannot draw the same round
+func (app *Config) claimRound(ctx context.Context, uId string) (*PlanRound, int, error) {
+	key := planKey(uId)
+	var round PlanRound
+	var index int
+
+	txf := func(tx *redis.Tx) error {
+		fields, err := tx.HMGet(ctx, key, "rounds", "next").Result()
+		if err != nil {
+			return err
+		}
+		if fields[0] == nil {
+			return errPlanNotFound
+		}
+
+		var rounds []PlanRound
+		err = json.Unmarshal([]byte(fields[0].(string)), &rounds)
+		if err != nil {
+			return err
+		}
+		index, _ = strconv.Atoi(fmt.Sprint(fields[1]))
+		if index >= len(rounds) {
+			return errPlanComplete
+		}
+		round = rounds[index]
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, "next", index+1)
+			return nil
+		})
+		return err
+	}
+
+	err := app.Rdb.Watch(ctx, txf, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &round, index, nil
+}
+
+// releaseRound hands a claimed round back when it could not be drawn
+func (app *Config) releaseRound(ctx context.Context, uId string, index int) error {
+	released, err := releaseRoundScript.Run(ctx, app.Rdb, []string{planKey(uId)}, index).Int()
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		log.Println("Round", index+1, "of", uId, "was not handed back, a later round was claimed meanwhile")
+	}
+	return nil
+}
+
+func (app *Config) hasPlan(ctx context.Context, uId string) (bool, error) {
+	exists, err := app.Rdb.Exists(ctx, planKey(uId)).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
+
+// replacePlanWinner swaps a forfeited winner of a round for the one drawn in their place
+func (app *Config) replacePlanWinner(ctx context.Context, uId string, index int, forfeited, replacement string) error {
+	encoded, err := app.Rdb.HGet(ctx, planKey(uId), winnersField(index)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var winners []string
+	err = json.Unmarshal([]byte(encoded), &winners)
+	if err != nil {
+		return err
+	}
+
+	for i, winner := range winners {
+		if winner == forfeited {
+			winners[i] = replacement
+			break
+		}
+	}
+
+	updated, err := json.Marshal(winners)
+	if err != nil {
+		return err
+	}
+	return app.Rdb.HSet(ctx, planKey(uId), winnersField(index), updated).Err()
+}
+
+func (app *Config) SetPlan(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	var requestPayload struct {
+		Rounds []PlanRound `json:"rounds"`
+	}
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if len(requestPayload.Rounds) == 0 {
+		app.errorJson(w, newError(CodeBadRequest, "a plan needs at least one round"))
+		return
+	}
+	for i := range requestPayload.Rounds {
+		round := &requestPayload.Rounds[i]
+		round.Round = i + 1
+		round.Prize = strings.TrimSpace(round.Prize)
+		round.Winners = nil
+		if round.Prize == "" {
+			app.errorJson(w, errorf(CodeBadRequest, "round %d needs a prize", round.Round))
+			return
+		}
+		if round.Count < 1 || round.Count > maxDrawCount {
+			app.errorJson(w, errorf(CodeBadRequest, "round %d: count must be between 1 and %d", round.Round, maxDrawCount))
+			return
+		}
+	}
+
+	meta, err := app.openDrawForChange(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	plan, err := app.drawPlan(ctx, uId)
+	if err != nil && !errors.Is(err, errPlanNotFound) {
+		app.errorJson(w, err)
+		return
+	}
+	if plan != nil && plan.Next > 0 {
+		app.errorJson(w, errPlanStarted)
+		return
+	}
+
+	rounds, err := json.Marshal(requestPayload.Rounds)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	pipe := app.Rdb.TxPipeline()
+	pipe.Del(ctx, planKey(uId))
+	pipe.HSet(ctx, planKey(uId), "rounds", rounds, "next", 0)
+	pipe.ExpireAt(ctx, planKey(uId), meta.ExpiresAt.Add(drawRetention))
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	app.writePlan(w, uId)
+}
+
+func (app *Config) GetPlan(w http.ResponseWriter, r *http.Request) {
+	app.writePlan(w, chi.URLParam(r, "id"))
+}
+
+func (app *Config) NextRound(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	round, index, err := app.claimRound(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	winners, warning, err := app.runDraw(ctx, DrawRun{
+		UId:       uId,
+		Count:     round.Count,
+		Requester: authUser(r),
+		Round:     round.Round,
+		Prize:     round.Prize,
+	})
+	if err != nil {
+		// hand the round back so it can be drawn once the pool is fixed
+		releaseErr := app.releaseRound(ctx, uId, index)
+		if releaseErr != nil {
+			log.Println("Error handing back round", releaseErr)
+		}
+		app.errorJson(w, err)
+		return
+	}
+
+	encoded, err := json.Marshal(winners)
+	if err == nil {
+		err = app.Rdb.HSet(ctx, planKey(uId), winnersField(index), encoded).Err()
+	}
+	if err != nil {
+		log.Println("Error saving round winners", err)
+	}
+
+	round.Winners = winners
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: warning,
+		Data:    round,
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) writePlan(w http.ResponseWriter, uId string) {
+	plan, err := app.drawPlan(context.Background(), uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    plan,
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClaimRound(t *testing.T) {
+	app, mr := newTestApp(t)
+	ctx := context.Background()
+
+	_, _, err := app.claimRound(ctx, "plan")
+	if !errors.Is(err, errPlanNotFound) {
+		t.Fatalf("claim without a plan error = %v, want errPlanNotFound", err)
+	}
+
+	mr.HSet(planKey("plan"), "rounds", `[{"round":1,"prize":"mug","count":2},{"round":2,"prize":"trip","count":1}]`, "next", "0")
+
+	for i, want := range []string{"mug", "trip"} {
+		round, index, err := app.claimRound(ctx, "plan")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != i || round.Prize != want {
+			t.Errorf("claim %d = round %d %q, want round %d %q", i+1, index, round.Prize, i, want)
+		}
+	}
+
+	_, _, err = app.claimRound(ctx, "plan")
+	if !errors.Is(err, errPlanComplete) {
+		t.Errorf("claim past the last round error = %v, want errPlanComplete", err)
+	}
+}
+
+func TestReleaseRound(t *testing.T) {
+	app, mr := newTestApp(t)
+	ctx := context.Background()
+
+	mr.HSet(planKey("plan"), "rounds", `[{"round":1,"prize":"mug","count":1},{"round":2,"prize":"trip","count":1}]`, "next", "0")
+
+	_, first, err := app.claimRound(ctx, "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a round that failed to draw goes back to the next claim
+	err = app.releaseRound(ctx, "plan", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	round, index, err := app.claimRound(ctx, "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != first || round.Prize != "mug" {
+		t.Errorf("claim after release = round %d %q, want round %d again", index, round.Prize, first)
+	}
+
+	// once a later round is claimed the old one must not move the cursor back
+	_, _, err = app.claimRound(ctx, "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.releaseRound(ctx, "plan", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := mr.HGet(planKey("plan"), "next"); next != "2" {
+		t.Errorf("next = %s after a stale release, want 2", next)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	pollStatusOpen   = "open"
+	pollStatusClosed = "closed"
+
+	pollEventVote  = "vote"
+	pollEventClose = "close"
+
+	defaultPollDuration = 30 * time.Minute
+	maxPollDuration     = 24 * time.Hour
+	// closed polls stay readable so the team can look up where they went
+	pollRetention = 7 * 24 * time.Hour
+)
+
+var (
+	errPollNotFound = newError(CodeNotFound, "poll not found")
+	errPollClosed   = newError(CodeConflict, "poll is closed")
+	errNotCandidate = newError(CodeBadRequest, "restaurant is not one of the poll candidates")
+)
+
+type RestaurantPoll struct {
+	ID         string          `json:"id"`
+	Status     string          `json:"status"`
+	Deadline   time.Time       `json:"deadline"`
+	Candidates []RestaurantRes `json:"candidates"`
+	// votes per candidate key, every candidate is listed
+	Tally  map[string]int64 `json:"tally"`
+	Winner *RestaurantRes   `json:"winner,omitempty"`
+
+	team string
+}
+
+type PollEvent struct {
+	Type      string           `json:"type"`
+	PollID    string           `json:"pollId"`
+	Tally     map[string]int64 `json:"tally"`
+	Winner    string           `json:"winner,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+func pollKey(id string) string {
+	return fmt.Sprintf("poll:%s", id)
+}
+
+// voter -> candidate key, a second vote moves the first one
+func pollVotesKey(id string) string {
+	return fmt.Sprintf("poll:%s:votes", id)
+}
+
+// candidate key -> votes, read directly for live tallies
+func pollTallyKey(id string) string {
+	return fmt.Sprintf("poll:%s:tally", id)
+}
+
+// open polls of a team by deadline, so the next draw can close the ones nobody looked at
+func teamPollsKey(team string) string {
+	return fmt.Sprintf("restaurant:polls:%s", team)
+}
+
+func pollChannel(id string) string {
+	return fmt.Sprintf("poll:%s:events", id)
+}
+
+// returns -1 when the poll does not exist, -2 once it is closed or past its
+// deadline, -3 for an unknown candidate, 0 when the vote did not change
+var votePollScript = redis.NewScript(`
+local deadline = redis.call('HGET', KEYS[1], 'deadline')
+if not deadline then
+	return -1
+end
+if redis.call('HGET', KEYS[1], 'status') ~= 'open' or tonumber(ARGV[3]) >= tonumber(deadline) then
+	return -2
+end
+if redis.call('HEXISTS', KEYS[3], ARGV[2]) == 0 then
+	return -3
+end
+local previous = redis.call('HGET', KEYS[2], ARGV[1])
+if previous == ARGV[2] then
+	return 0
+end
+if previous then
+	redis.call('HINCRBY', KEYS[3], previous, -1)
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+redis.call('PEXPIREAT', KEYS[2], ARGV[4])
+redis.call('HINCRBY', KEYS[3], ARGV[2], 1)
+return 1
+`)
+
+// closes a poll that is past its deadline and returns the winner, ties go to the
+// candidate drawn first. nil when it is still running or was already closed
+var closePollScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'status') ~= 'open' then
+	return false
+end
+if tonumber(ARGV[1]) < tonumber(redis.call('HGET', KEYS[1], 'deadline')) then
+	return false
+end
+local winner, best = '', 0
+for i = 2, #ARGV do
+	local votes = tonumber(redis.call('HGET', KEYS[2], ARGV[i]) or '0')
+	if votes > best then
+		winner, best = ARGV[i], votes
+	end
+end
+redis.call('HSET', KEYS[1], 'status', 'closed', 'winner', winner)
+return winner
+`)
+
+func (app *Config) createPoll(ctx context.Context, team string, candidates []RestaurantRes, deadline time.Time) (*RestaurantPoll, error) {
+	poll := &RestaurantPoll{
+		ID:         uuid.NewString(),
+		Status:     pollStatusOpen,
+		Deadline:   deadline,
+		Candidates: candidates,
+		Tally:      map[string]int64{},
+		team:       team,
+	}
+
+	candidatesJSON, err := json.Marshal(candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	tally := make([]any, 0, len(candidates)*2)
+	for _, candidate := range candidates {
+		poll.Tally[candidate.key()] = 0
+		tally = append(tally, candidate.key(), 0)
+	}
+
+	expireAt := deadline.Add(pollRetention)
+
+	_, err = app.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, pollKey(poll.ID),
+			"team", team,
+			"status", pollStatusOpen,
+			"deadline", deadline.UnixMilli(),
+			"candidates", candidatesJSON,
+		)
+		pipe.ExpireAt(ctx, pollKey(poll.ID), expireAt)
+		pipe.HSet(ctx, pollTallyKey(poll.ID), tally...)
+		pipe.ExpireAt(ctx, pollTallyKey(poll.ID), expireAt)
+		pipe.ZAdd(ctx, teamPollsKey(team), redis.Z{Score: float64(deadline.UnixMilli()), Member: poll.ID})
+		pipe.Expire(ctx, teamPollsKey(team), maxPollDuration+pollRetention)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return poll, nil
+}
+
+// closeExpiredPolls closes the team's polls that are past their deadline, nothing
+// else closes a poll nobody reads, votes on or watches
+func (app *Config) closeExpiredPolls(ctx context.Context, team string) error {
+	key := teamPollsKey(team)
+
+	ids, err := app.Rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		// loading a poll past its deadline closes it
+		_, err = app.poll(ctx, id)
+		if err != nil && !errors.Is(err, errPollNotFound) {
+			return err
+		}
+
+		err = app.Rdb.ZRem(ctx, key, id).Err()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poll loads a poll with its current tally, closing it first when the deadline passed
+func (app *Config) poll(ctx context.Context, id string) (*RestaurantPoll, error) {
+	fields, err := app.Rdb.HGetAll(ctx, pollKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errPollNotFound
+	}
+
+	deadline, err := strconv.ParseInt(fields["deadline"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	poll := &RestaurantPoll{
+		ID:       id,
+		Status:   fields["status"],
+		Deadline: time.UnixMilli(deadline).UTC(),
+		team:     fields["team"],
+	}
+
+	err = json.Unmarshal([]byte(fields["candidates"]), &poll.Candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	poll.Tally, err = app.pollTally(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if poll.Status == pollStatusOpen && !time.Now().Before(poll.Deadline) {
+		err = app.closePoll(ctx, poll)
+		if err != nil {
+			return nil, err
+		}
+		return app.poll(ctx, id)
+	}
+
+	if winner := fields["winner"]; winner != "" {
+		for i := range poll.Candidates {
+			if poll.Candidates[i].key() == winner {
+				poll.Winner = &poll.Candidates[i]
+			}
+		}
+	}
+
+	return poll, nil
+}
+
+func (app *Config) pollTally(ctx context.Context, id string) (map[string]int64, error) {
+	counts, err := app.Rdb.HGetAll(ctx, pollTallyKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tally := make(map[string]int64, len(counts))
+	for key, count := range counts {
+		tally[key], err = strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tally, nil
+}
+
+// closePoll records the winner once, whoever notices the deadline first closes it.
+// until then the poll reads as open to redis, see closeExpiredPolls
+func (app *Config) closePoll(ctx context.Context, poll *RestaurantPoll) error {
+	args := []any{time.Now().UnixMilli()}
+	for _, candidate := range poll.Candidates {
+		args = append(args, candidate.key())
+	}
+
+	winner, err := closePollScript.Run(ctx, app.Rdb, []string{pollKey(poll.ID), pollTallyKey(poll.ID)}, args...).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the place the team picked sits out the cooldown from now on
+	if winner != "" {
+		err = app.rememberRestaurants(ctx, poll.team, []string{winner})
+		if err != nil {
+			log.Println("Error remembering poll winner", err)
+		}
+	}
+
+	tally, err := app.pollTally(ctx, poll.ID)
+	if err != nil {
+		return err
+	}
+
+	app.publishPollEvent(ctx, PollEvent{
+		Type:   pollEventClose,
+		PollID: poll.ID,
+		Tally:  tally,
+		Winner: winner,
+	})
+	return nil
+}
+
+func (app *Config) publishPollEvent(ctx context.Context, event PollEvent) {
+	event.Timestamp = time.Now()
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error encoding poll event", err)
+		return
+	}
+
+	err = app.Rdb.Publish(ctx, pollChannel(event.PollID), message).Err()
+	if err != nil {
+		log.Println("Error publishing poll event", err)
+	}
+}
+
+func (app *Config) GetPoll(w http.ResponseWriter, r *http.Request) {
+	poll, err := app.poll(context.Background(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    poll,
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+// VotePoll casts or moves the caller's vote, one per signed in user
+func (app *Config) VotePoll(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	id := chi.URLParam(r, "id")
+
+	var requestPayload struct {
+		Restaurant string `json:"restaurant"`
+	}
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	voter := "user:" + authUser(r)
+
+	poll, err := app.poll(ctx, id)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	result, err := votePollScript.Run(ctx, app.Rdb,
+		[]string{pollKey(id), pollVotesKey(id), pollTallyKey(id)},
+		voter, requestPayload.Restaurant, time.Now().UnixMilli(), poll.Deadline.Add(pollRetention).UnixMilli(),
+	).Int()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	switch result {
+	case -1:
+		app.errorJson(w, errPollNotFound)
+		return
+	case -2:
+		// the deadline passed between loading and voting
+		err = app.closePoll(ctx, poll)
+		if err != nil {
+			log.Println("Error closing poll", err)
+		}
+		app.errorJson(w, errPollClosed)
+		return
+	case -3:
+		app.errorJson(w, errNotCandidate)
+		return
+	}
+
+	poll.Tally, err = app.pollTally(ctx, id)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if result == 1 {
+		app.publishPollEvent(ctx, PollEvent{
+			Type:   pollEventVote,
+			PollID: id,
+			Tally:  poll.Tally,
+		})
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    poll,
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+// PollEvents streams tallies as votes come in and the winner once the deadline hits
+func (app *Config) PollEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	id := chi.URLParam(r, "id")
+
+	poll, err := app.poll(ctx, id)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if poll.Status == pollStatusOpen {
+		timer := time.AfterFunc(time.Until(poll.Deadline), func() {
+			err := app.closePoll(ctx, poll)
+			if err != nil {
+				log.Println("Error closing poll", err)
+			}
+		})
+		defer timer.Stop()
+	}
+
+	app.streamEvents(w, r, pollChannel(id))
+}
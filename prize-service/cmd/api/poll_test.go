@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+func vote(app *Config, pollID, user, restaurant string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/polls/"+pollID+"/vote", strings.NewReader(fmt.Sprintf(`{"restaurant":%q}`, restaurant)))
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", pollID)
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, userContextKey, user)
+
+	w := httptest.NewRecorder()
+	app.VotePoll(w, r.WithContext(ctx))
+	return w
+}
+
+func votedTally(t *testing.T, w *httptest.ResponseRecorder) map[string]int64 {
+	t.Helper()
+
+	var response struct {
+		Data RestaurantPoll `json:"data"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.Data.Tally
+}
+
+func TestVotePoll(t *testing.T) {
+	app, _ := newTestApp(t)
+	ctx := context.Background()
+
+	candidates := []RestaurantRes{{PlaceID: "pho", Name: "Pho"}, {PlaceID: "taco", Name: "Taco"}}
+	poll, err := app.createPoll(ctx, "team:lunch", candidates, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vote(app, poll.ID, "alice", "pho")
+	w := vote(app, poll.ID, "bob", "pho")
+	if tally := votedTally(t, w); tally["pho"] != 2 || tally["taco"] != 0 {
+		t.Errorf("tally = %v, want two votes for pho", tally)
+	}
+
+	// a second vote moves the first one instead of counting twice
+	w = vote(app, poll.ID, "alice", "taco")
+	if tally := votedTally(t, w); tally["pho"] != 1 || tally["taco"] != 1 {
+		t.Errorf("tally after alice moved the vote = %v, want one each", tally)
+	}
+	w = vote(app, poll.ID, "alice", "taco")
+	if tally := votedTally(t, w); tally["taco"] != 1 {
+		t.Errorf("tally after the same vote again = %v, want it unchanged", tally)
+	}
+
+	if w = vote(app, poll.ID, "alice", "sushi"); w.Code != http.StatusBadRequest {
+		t.Errorf("vote for a place that is no candidate = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w = vote(app, "missing", "alice", "pho"); w.Code != http.StatusNotFound {
+		t.Errorf("vote on an unknown poll = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestClosePoll(t *testing.T) {
+	app, mr := newTestApp(t)
+	ctx := context.Background()
+
+	candidates := []RestaurantRes{{PlaceID: "pho"}, {PlaceID: "taco"}, {PlaceID: "ramen"}}
+	poll, err := app.createPoll(ctx, "team:lunch", candidates, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vote(app, poll.ID, "alice", "taco")
+	vote(app, poll.ID, "bob", "ramen")
+
+	// move the deadline into the past instead of waiting for it
+	mr.HSet(pollKey(poll.ID), "deadline", fmt.Sprint(time.Now().Add(-time.Second).UnixMilli()))
+
+	if w := vote(app, poll.ID, "carol", "ramen"); w.Code != http.StatusConflict {
+		t.Errorf("vote after the deadline = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	closed, err := app.poll(ctx, poll.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// taco and ramen tie, the candidate drawn first wins
+	if closed.Status != pollStatusClosed || closed.Winner == nil || closed.Winner.PlaceID != "taco" {
+		t.Fatalf("poll = %s with winner %+v, want closed with taco", closed.Status, closed.Winner)
+	}
+	if closed.Tally["ramen"] != 1 {
+		t.Errorf("tally = %v, want the late vote left out", closed.Tally)
+	}
+
+	recent, err := app.recentRestaurants(ctx, "team:lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 1 || recent[0] != "taco" {
+		t.Errorf("recent = %v, want the winner to start its cooldown", recent)
+	}
+}
+
+func TestCloseExpiredPolls(t *testing.T) {
+	app, _ := newTestApp(t)
+	ctx := context.Background()
+
+	expired, err := app.createPoll(ctx, "team:lunch", []RestaurantRes{{PlaceID: "pho"}}, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, err := app.createPoll(ctx, "team:lunch", []RestaurantRes{{PlaceID: "taco"}}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.closeExpiredPolls(ctx, "team:lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := app.Rdb.HGet(ctx, pollKey(expired.ID), "status").Val(); status != pollStatusClosed {
+		t.Errorf("expired poll status = %q, want closed", status)
+	}
+	if status := app.Rdb.HGet(ctx, pollKey(running.ID), "status").Val(); status != pollStatusOpen {
+		t.Errorf("running poll status = %q, want open", status)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// limits per route group, RATE_LIMITS overrides them with name=limit/window pairs.
+// "auth" runs before the credentials are checked, so it counts every address
+// including the ones guessing keys and tokens
+var defaultRateLimits = map[string]RateLimit{
+	"auth":       {Limit: 600, Window: time.Minute},
+	"api":        {Limit: 300, Window: time.Minute},
+	"create":     {Limit: 20, Window: time.Minute},
+	"draw":       {Limit: 60, Window: time.Minute},
+	"restaurant": {Limit: 10, Window: time.Minute},
+}
+
+var errRateLimited = newError(CodeRateLimited, "too many requests, slow down")
+
+// keeps one sorted set member per request inside the window, returns how many
+// milliseconds the caller has to wait (0 when allowed) and the requests left
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count >= limit then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	return {tonumber(oldest[2]) + window - now, 0}
+end
+redis.call('ZADD', KEYS[1], now, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], window)
+return {0, limit - count - 1}
+`)
+
+func parseRateLimits(value string) (map[string]RateLimit, error) {
+	limits := map[string]RateLimit{}
+	for name, limit := range defaultRateLimits {
+		limits[name] = limit
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, rule, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q, expected name=limit/window", pair)
+		}
+		count, window, ok := strings.Cut(rule, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q, expected name=limit/window", pair)
+		}
+
+		limit, err := strconv.Atoi(count)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid rate limit %q: limit must be a positive number", pair)
+		}
+		duration, err := time.ParseDuration(window)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q: window must be a positive duration", pair)
+		}
+
+		limits[strings.TrimSpace(name)] = RateLimit{Limit: limit, Window: duration}
+	}
+	return limits, nil
+}
+
+// realIP swaps RemoteAddr for the client address a trusted proxy forwarded. anyone
+// else can put whatever they like in those headers, so they are ignored
+func (app *Config) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := forwardedIP(r, app.TrustedProxies); ip != "" {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedIP walks X-Forwarded-For from the right, every hop our proxies added
+// is skipped and the first other one is the client. empty when the request did
+// not come through a trusted proxy
+func forwardedIP(r *http.Request, trusted []netip.Prefix) string {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !isTrustedProxy(remote.Addr(), trusted) {
+		return ""
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !isTrustedProxy(addr, trusted) {
+			return client
+		}
+	}
+	if client != "" {
+		return client
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return ""
+}
+
+// rateClient counts signed in users by name and everyone else by address, limits
+// in front of authenticate only ever see the address
+func rateClient(r *http.Request) string {
+	if user := authUser(r); user != "" {
+		return "user:" + user
+	}
+	return "ip:" + requester(r)
+}
+
+// rateLimited throttles the routes it wraps with the limit configured under name
+func (app *Config) rateLimited(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, ok := app.RateLimits[name]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			b := make([]byte, 8)
+			rand.Read(b)
+			now := time.Now().UnixMilli()
+			key := fmt.Sprintf("ratelimit:%s:%s", name, rateClient(r))
+
+			result, err := slidingWindowScript.Run(context.Background(), app.Rdb, []string{key},
+				now, limit.Window.Milliseconds(), limit.Limit, fmt.Sprintf("%d-%s", now, hex.EncodeToString(b)),
+			).Int64Slice()
+			if err != nil {
+				// an unreachable redis should not take the whole api down with it
+				log.Println("Error checking rate limit", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(result[1], 10))
+
+			if result[0] > 0 {
+				retryAfter := int(math.Ceil(float64(result[0]) / 1000))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				app.errorJson(w, errRateLimited)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
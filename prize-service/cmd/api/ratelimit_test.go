@@ -0,0 +1,151 @@
+package main
+
+import (
+	"maps"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	withDefaults := func(overrides map[string]RateLimit) map[string]RateLimit {
+		limits := maps.Clone(defaultRateLimits)
+		maps.Copy(limits, overrides)
+		return limits
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]RateLimit
+		wantErr string
+	}{
+		{name: "unset keeps the defaults", value: "", want: defaultRateLimits},
+		{
+			name:  "overrides one group",
+			value: "draw=5/10s",
+			want:  withDefaults(map[string]RateLimit{"draw": {Limit: 5, Window: 10 * time.Second}}),
+		},
+		{
+			name:  "spaces and a new group",
+			value: " restaurant=2/1m , export=1/1h ,",
+			want: withDefaults(map[string]RateLimit{
+				"restaurant": {Limit: 2, Window: time.Minute},
+				"export":     {Limit: 1, Window: time.Hour},
+			}),
+		},
+		{name: "missing equals", value: "draw", wantErr: "expected name=limit/window"},
+		{name: "missing window", value: "draw=5", wantErr: "expected name=limit/window"},
+		{name: "zero limit", value: "draw=0/1m", wantErr: "limit must be a positive number"},
+		{name: "bad limit", value: "draw=lots/1m", wantErr: "limit must be a positive number"},
+		{name: "bad window", value: "draw=5/soon", wantErr: "window must be a positive duration"},
+		{name: "negative window", value: "draw=5/-1m", wantErr: "window must be a positive duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRateLimits(tt.value)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("limits = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// overrides must not leak into the defaults
+	if defaultRateLimits["draw"].Limit != 60 {
+		t.Errorf("defaults were changed to %v", defaultRateLimits["draw"])
+	}
+}
+
+func TestForwardedIP(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{name: "direct client is ignored", remote: "203.0.113.9:5000", forwarded: []string{"1.2.3.4"}, want: ""},
+		{name: "direct client real ip is ignored", remote: "203.0.113.9:5000", realIP: "1.2.3.4", want: ""},
+		{name: "single proxy", remote: "10.0.0.2:5000", forwarded: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "spoofed hop left of the client", remote: "10.0.0.2:5000", forwarded: []string{"1.2.3.4, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "proxy chain", remote: "10.0.0.2:5000", forwarded: []string{"198.51.100.7, 10.1.1.1", "192.168.1.1"}, want: "198.51.100.7"},
+		{name: "only proxies", remote: "10.0.0.2:5000", forwarded: []string{"10.9.9.9, 10.1.1.1"}, want: "10.9.9.9"},
+		{name: "real ip from proxy", remote: "192.168.1.1:5000", realIP: "198.51.100.7", want: "198.51.100.7"},
+		{name: "garbage real ip", remote: "192.168.1.1:5000", realIP: "nope", want: ""},
+		{name: "mapped ipv4", remote: "[::ffff:10.0.0.2]:5000", forwarded: []string{"::ffff:198.51.100.7"}, want: "198.51.100.7"},
+		{name: "other host of a single address", remote: "192.168.1.2:5000", forwarded: []string{"1.2.3.4"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			got := forwardedIP(r, trusted)
+			if got != tt.want {
+				t.Errorf("forwardedIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "10.0.0.1", want: []string{"10.0.0.1/32"}},
+		{value: "10.0.0.1/8, ::1", want: []string{"10.0.0.0/8", "::1/128"}},
+		{value: "proxy.internal", wantErr: true},
+		{value: "10.0.0.0/40", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTrustedProxies(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTrustedProxies(%q) succeeded, want an error", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTrustedProxies(%q) failed: %v", tt.value, err)
+			continue
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("parseTrustedProxies(%q) = %v, want %v", tt.value, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].String() != tt.want[i] {
+				t.Errorf("parseTrustedProxies(%q)[%d] = %s, want %s", tt.value, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
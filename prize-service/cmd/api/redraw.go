@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"prize-service/data"
+	"slices"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var errNothingToRedraw = newError(CodeConflict, "draw has no winner to redraw")
+
+// returnToPool puts a forfeited winner back so they can be drawn again
+func (app *Config) returnToPool(ctx context.Context, meta *DrawMeta, name string) error {
+	weighted, err := app.isWeighted(ctx, meta.ID)
+	if err != nil {
+		return err
+	}
+
+	if !weighted {
+		return app.modifyPool(ctx, meta, func(names []string) ([]string, error) {
+			if slices.Contains(names, name) {
+				return names, nil
+			}
+			return append(names, name), nil
+		})
+	}
+
+	exists, err := app.Rdb.HExists(ctx, weightsKey(meta.ID), name).Result()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return app.addWeightedEntry(ctx, meta.ID, DrawEntry{Name: name, Weight: 1, Quantity: 1}, false)
+	}
+	return app.Rdb.HIncrBy(ctx, stockKey(meta.ID), name, 1).Err()
+}
+
+// restoreWinner undoes the forfeit of a winner whose replacement could not be drawn
+func (app *Config) restoreWinner(ctx context.Context, meta *DrawMeta, last *data.DrawHistoryEntry) {
+	err := app.Models.DrawHistoryEntry.Unforfeit(last.ID)
+	if err != nil {
+		log.Println("Error restoring forfeited winner", err)
+	}
+
+	if meta.Event != "" {
+		app.Rdb.SAdd(ctx, eventWinnersKey(meta.Owner, meta.Event), last.Winner)
+	}
+}
+
+// reopenDraw puts a draw the replacement emptied back in play once the forfeited name returned
+func (app *Config) reopenDraw(ctx context.Context, uId string) {
+	meta, err := app.drawMeta(ctx, uId)
+	if err != nil {
+		log.Println("Error reading draw status", err)
+		return
+	}
+
+	if meta.Status == drawStatusExhausted {
+		err = app.setDrawStatus(ctx, uId, drawStatusOpen)
+		if err != nil {
+			log.Println("Error updating draw status", err)
+		}
+	}
+}
+
+func (app *Config) Redraw(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	var requestPayload struct {
+		ReturnToPool bool `json:"returnToPool"`
+	}
+
+	if r.ContentLength != 0 {
+		err := app.readJson(w, r, &requestPayload)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	meta, err := app.openDrawForChange(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	if requestPayload.ReturnToPool {
+		seed, err := app.fairSeed(ctx, uId)
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		if seed != nil {
+			app.errorJson(w, newError(CodeConflict, "a fair draw cannot take a winner back into the pool"))
+			return
+		}
+	}
+
+	last, err := app.lastWinner(ctx, uId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		app.errorJson(w, errNothingToRedraw)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// forfeiting first makes a second redraw of the same winner fail
+	err = app.Models.DrawHistoryEntry.Forfeit(last.ID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		app.errorJson(w, newError(CodeConflict, "winner was already redrawn"))
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// the forfeited name did not win anything, sibling draws may pick it again
+	if meta.Event != "" {
+		app.Rdb.SRem(ctx, eventWinnersKey(meta.Owner, meta.Event), last.Winner)
+	}
+
+	winners, warning, err := app.runDraw(ctx, DrawRun{
+		UId:       uId,
+		Count:     1,
+		Requester: authUser(r),
+		Round:     last.Round,
+		Prize:     last.Prize,
+		Skip:      last.Winner,
+	})
+	if err != nil {
+		// nobody replaced them, so they are still the winner
+		app.restoreWinner(ctx, meta, last)
+		app.errorJson(w, err)
+		return
+	}
+
+	// only now, so the absent winner cannot be drawn as their own replacement
+	returned := false
+	if requestPayload.ReturnToPool {
+		err = app.returnToPool(ctx, meta, last.Winner)
+		if err != nil {
+			log.Println("Error returning forfeited winner to the pool", err)
+		} else {
+			returned = true
+			app.reopenDraw(ctx, uId)
+		}
+	}
+
+	if last.Round > 0 {
+		err = app.replacePlanWinner(ctx, uId, last.Round-1, last.Winner, winners[0])
+		if err != nil {
+			log.Println("Error updating round winners", err)
+		}
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: warning,
+		Data: struct {
+			Forfeited string   `json:"forfeited"`
+			Returned  bool     `json:"returned"`
+			Name      string   `json:"name"`
+			Names     []string `json:"names"`
+		}{
+			Forfeited: last.Winner,
+			Returned:  returned,
+			Name:      winners[0],
+			Names:     winners,
+		},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
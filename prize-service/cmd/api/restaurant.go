@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"prize-service/data"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRestaurantCount = 3
+	maxRestaurantCount     = 10
+
+	// how long a drawn place sits out for the same team, RESTAURANT_COOLDOWN overrides it
+	defaultRestaurantCooldown = 72 * time.Hour
+
+	// meters, roughly a ten minute walk
+	defaultRestaurantRadius = 800
+	maxRestaurantRadius     = 5000
+)
+
+type RestaurantRes struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Address  string         `json:"address"`
+	Rating   float64        `json:"rating"`
+	PlaceID  string         `json:"placeId"`
+	Area     string         `json:"area"`
+	Types    []string       `json:"types,omitempty"`
+	Location *data.GeoPoint `json:"location,omitempty"`
+	// meters, only set when the draw was made from a location
+	Distance *float64 `json:"distance,omitempty"`
+}
+
+func restaurantRes(restaurant *data.RestaurantEntry) RestaurantRes {
+	return RestaurantRes{
+		ID:       restaurant.ID.Hex(),
+		Name:     restaurant.Name,
+		Address:  restaurant.Address,
+		Rating:   restaurant.Rating,
+		PlaceID:  restaurant.PlaceID,
+		Area:     restaurant.Area,
+		Types:    restaurant.Types,
+		Location: restaurant.Location,
+	}
+}
+
+// key prefers the place id, entries saved without one fall back to the mongo id.
+// poll votes and team cooldowns use it
+func (res RestaurantRes) key() string {
+	if res.PlaceID != "" {
+		return res.PlaceID
+	}
+	return res.ID
+}
+
+// RestaurantDrawRequest narrows the catalog down before picking, empty fields match everything
+type RestaurantDrawRequest struct {
+	Areas     []string `json:"areas"`
+	MinRating float64  `json:"min_rating"`
+	Types     []string `json:"types"`
+	Count     int      `json:"count"`
+	// places drawn for the same team recently are skipped, defaults to the caller
+	Team string `json:"team"`
+	// poll opens a vote on the drawn places that closes at poll_deadline
+	Poll         bool       `json:"poll"`
+	PollDeadline *time.Time `json:"poll_deadline"`
+	// with a location only places within radius meters of it are drawn
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Radius    float64  `json:"radius"`
+}
+
+func (req *RestaurantDrawRequest) nearby() bool {
+	return req.Latitude != nil && req.Longitude != nil
+}
+
+func (req *RestaurantDrawRequest) validate() error {
+	for i := range req.Areas {
+		req.Areas[i] = strings.TrimSpace(req.Areas[i])
+	}
+	for i := range req.Types {
+		req.Types[i] = strings.ToLower(strings.TrimSpace(req.Types[i]))
+	}
+	if req.Count == 0 {
+		req.Count = defaultRestaurantCount
+	}
+	if req.Count < 1 || req.Count > maxRestaurantCount {
+		return errorf(CodeBadRequest, "count must be between 1 and %d", maxRestaurantCount)
+	}
+	if req.MinRating < 0 || req.MinRating > 5 {
+		return newError(CodeBadRequest, "min_rating must be between 0 and 5")
+	}
+
+	if req.PollDeadline != nil && !req.Poll {
+		return newError(CodeBadRequest, "poll_deadline needs poll")
+	}
+	if req.Poll {
+		if req.PollDeadline == nil {
+			deadline := time.Now().Add(defaultPollDuration)
+			req.PollDeadline = &deadline
+		}
+		if !req.PollDeadline.After(time.Now()) {
+			return newError(CodeBadRequest, "poll_deadline must be in the future")
+		}
+		if req.PollDeadline.After(time.Now().Add(maxPollDuration)) {
+			return errorf(CodeBadRequest, "poll_deadline must be within %s", maxPollDuration)
+		}
+	}
+
+	if (req.Latitude == nil) != (req.Longitude == nil) {
+		return newError(CodeBadRequest, "latitude and longitude must be sent together")
+	}
+	if !req.nearby() {
+		if req.Radius != 0 {
+			return newError(CodeBadRequest, "radius needs a latitude and longitude")
+		}
+		return nil
+	}
+
+	if *req.Latitude < -90 || *req.Latitude > 90 || *req.Longitude < -180 || *req.Longitude > 180 {
+		return newError(CodeBadRequest, "latitude or longitude is out of range")
+	}
+	if req.Radius == 0 {
+		req.Radius = defaultRestaurantRadius
+	}
+	if req.Radius < 0 || req.Radius > maxRestaurantRadius {
+		return errorf(CodeBadRequest, "radius must be between 1 and %d meters", maxRestaurantRadius)
+	}
+	return nil
+}
+
+// filter leaves the places in exclude out of the catalog the request narrows down
+func (req *RestaurantDrawRequest) filter(exclude []string) data.RestaurantFilter {
+	filter := data.RestaurantFilter{
+		Areas:     req.Areas,
+		MinRating: req.MinRating,
+		Types:     req.Types,
+		Exclude:   exclude,
+	}
+	if req.nearby() {
+		filter.Near = data.NewGeoPoint(*req.Latitude, *req.Longitude)
+		filter.Radius = req.Radius
+	}
+	return filter
+}
+
+func restaurantCooldownKey(team string) string {
+	return fmt.Sprintf("restaurant:cooldown:%s", team)
+}
+
+// restaurantTeam groups draws by the team in the body, which only its members may
+// name, or by whoever is asking
+func (app *Config) restaurantTeam(r *http.Request, req *RestaurantDrawRequest) (string, error) {
+	team := strings.ToLower(strings.TrimSpace(req.Team))
+	if team == "" {
+		return rateClient(r), nil
+	}
+
+	user := authUser(r)
+	if user == "" {
+		return "", newError(CodeUnauthorized, "sign in to draw for a team")
+	}
+	if !app.Teams[team][user] {
+		return "", errorf(CodeForbidden, "you are not a member of team %q", team)
+	}
+	return "team:" + team, nil
+}
+
+func (app *Config) restaurantCooldown() time.Duration {
+	if app.RestaurantCooldown == 0 {
+		return defaultRestaurantCooldown
+	}
+	return app.RestaurantCooldown
+}
+
+// recentRestaurants returns the places the team drew within the cooldown
+func (app *Config) recentRestaurants(ctx context.Context, team string) ([]string, error) {
+	key := restaurantCooldownKey(team)
+	since := time.Now().Add(-app.restaurantCooldown()).UnixMilli()
+
+	var recent *redis.StringSliceCmd
+	_, err := app.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(since, 10))
+		recent = pipe.ZRange(ctx, key, 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recent.Val(), nil
+}
+
+// rememberRestaurants starts the cooldown of the given place ids for the team
+func (app *Config) rememberRestaurants(ctx context.Context, team string, ids []string) error {
+	key := restaurantCooldownKey(team)
+	now := time.Now()
+
+	members := make([]redis.Z, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, redis.Z{Score: float64(now.UnixMilli()), Member: id})
+	}
+
+	_, err := app.Rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, app.restaurantCooldown())
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"prize-service/data"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	errRestaurantNotFound = newError(CodeNotFound, "restaurant not found")
+	errDuplicatePlace     = newError(CodeConflict, "a restaurant with this placeId already exists")
+)
+
+// RestaurantInput is the body of POST and PUT /restaurants, PUT replaces every field
+type RestaurantInput struct {
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	Rating    float64  `json:"rating"`
+	PlaceID   string   `json:"placeId"`
+	Area      string   `json:"area"`
+	Types     []string `json:"types"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+func (input *RestaurantInput) entry() (data.RestaurantEntry, error) {
+	entry := data.RestaurantEntry{
+		Name:    strings.TrimSpace(input.Name),
+		Address: strings.TrimSpace(input.Address),
+		Rating:  input.Rating,
+		PlaceID: strings.TrimSpace(input.PlaceID),
+		Area:    strings.TrimSpace(input.Area),
+	}
+	// draws match types in lower case, the way places come from the crawler
+	for _, t := range input.Types {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			entry.Types = append(entry.Types, t)
+		}
+	}
+
+	if entry.Name == "" {
+		return entry, newError(CodeBadRequest, "name is required")
+	}
+	if entry.Rating < 0 || entry.Rating > 5 {
+		return entry, newError(CodeBadRequest, "rating must be between 0 and 5")
+	}
+
+	if (input.Latitude == nil) != (input.Longitude == nil) {
+		return entry, newError(CodeBadRequest, "latitude and longitude must be sent together")
+	}
+	if input.Latitude != nil {
+		if *input.Latitude < -90 || *input.Latitude > 90 || *input.Longitude < -180 || *input.Longitude > 180 {
+			return entry, newError(CodeBadRequest, "latitude or longitude is out of range")
+		}
+		entry.Location = data.NewGeoPoint(*input.Latitude, *input.Longitude)
+	}
+
+	return entry, nil
+}
+
+func restaurantObjectID(r *http.Request) (bson.ObjectID, error) {
+	id, err := bson.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		return id, errRestaurantNotFound
+	}
+	return id, nil
+}
+
+func restaurantError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, bson.ErrInvalidHex) {
+		return errRestaurantNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return errDuplicatePlace
+	}
+	return err
+}
+
+func (app *Config) ListRestaurants(w http.ResponseWriter, r *http.Request) {
+	restaurants, err := app.Models.RestaurantEntry.All()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	responseRestaurants := make([]RestaurantRes, 0, len(restaurants))
+	for _, restaurant := range restaurants {
+		responseRestaurants = append(responseRestaurants, restaurantRes(restaurant))
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data: struct {
+			Restaurants []RestaurantRes `json:"restaurants"`
+		}{
+			Restaurants: responseRestaurants,
+		},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) GetRestaurant(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := app.Models.RestaurantEntry.GetOne(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, restaurantError(err))
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    restaurantRes(restaurant),
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
+	var requestPayload RestaurantInput
+
+	err := app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	entry, err := requestPayload.entry()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	// the unique index on placeid allows only one empty value, places google
+	// does not know get an id of their own
+	if entry.PlaceID == "" {
+		entry.PlaceID = "manual:" + bson.NewObjectID().Hex()
+	}
+
+	entry.ID, err = app.Models.RestaurantEntry.Insert(entry)
+	if err != nil {
+		app.errorJson(w, restaurantError(err))
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    restaurantRes(&entry),
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
+	id, err := restaurantObjectID(r)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	var requestPayload RestaurantInput
+
+	err = app.readJson(w, r, &requestPayload)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	entry, err := requestPayload.entry()
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	existing, err := app.Models.RestaurantEntry.GetOne(id.Hex())
+	if err != nil {
+		app.errorJson(w, restaurantError(err))
+		return
+	}
+
+	entry.ID = id
+	if entry.PlaceID == "" {
+		entry.PlaceID = existing.PlaceID
+	}
+
+	result, err := entry.Update()
+	if err != nil {
+		app.errorJson(w, restaurantError(err))
+		return
+	}
+	if result.MatchedCount == 0 {
+		app.errorJson(w, errRestaurantNotFound)
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    restaurantRes(&entry),
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) DeleteRestaurant(w http.ResponseWriter, r *http.Request) {
+	id, err := restaurantObjectID(r)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	result, err := app.Models.RestaurantEntry.Delete(id)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	if result.DeletedCount == 0 {
+		app.errorJson(w, errRestaurantNotFound)
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    struct{}{},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/go-chi/chi"
@@ -8,37 +9,108 @@ import (
 	"github.com/go-chi/cors"
 )
 
+func (app *Config) allowedOrigins() []string {
+	if len(app.AllowedOrigins) == 0 {
+		return defaultAllowedOrigins
+	}
+	return app.AllowedOrigins
+}
+
 func (app *Config) routes() http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(cors.Handler(cors.Options{
-		AllowedOrigins: []string{
-			"https://m790101.github.io",
-			"https://m790101.github.io/prize-draw",
-			"http://localhost:5174",
-		},
+		AllowedOrigins: app.allowedOrigins(),
 		AllowedMethods: []string{
 			"GET", "POST", "PUT", "DELETE",
 		},
 		AllowedHeaders: []string{
-			"Accept", "Authorization", "Content-Type", "X-CSRF-Token",
+			"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key", "X-API-Key", "X-Share-Token",
 		},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "Idempotent-Replayed", "Content-Disposition", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
+	mux.Use(app.realIP)
 	mux.Use(middleware.Heartbeat("/ping"))
 
 	mux.Route("/api/v1", func(r chi.Router) {
-		r.Post("/prizes", app.NewPrizes)
-		r.Patch("/prizes", app.UpdatePrized)
-		r.Post("/draw", app.DrawPrizes)
+		r.Use(app.rateLimited("auth"))
+		r.Use(app.authenticate)
+		r.Use(app.rateLimited("api"))
+		r.Use(app.validateRequest)
+
+		r.Get("/openapi.json", app.OpenAPI)
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.requireUser)
+
+			r.With(app.rateLimited("create"), app.idempotent).Post("/prizes", app.NewPrizes)
+			r.Patch("/prizes", app.UpdatePrized)
+			r.With(app.rateLimited("draw"), app.idempotent).Post("/draw", app.DrawPrizes)
+			r.With(app.rateLimited("create")).Post("/draws/import", app.ImportDraw)
+			r.Get("/events/{id}", app.GetEvent)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.requireAdmin)
 
-		r.Post("/restaurant/draw", app.DrawRestaurants)
+				r.Get("/restaurants", app.ListRestaurants)
+				r.Post("/restaurants", app.CreateRestaurant)
+				r.Get("/restaurants/{id}", app.GetRestaurant)
+				r.Put("/restaurants/{id}", app.UpdateRestaurant)
+				r.Delete("/restaurants/{id}", app.DeleteRestaurant)
+			})
+		})
+
+		r.Route("/draws/{id}", func(r chi.Router) {
+			// participants with a share token can follow the draw without changing it
+			r.Group(func(r chi.Router) {
+				r.Use(app.drawReadAccess)
+
+				r.Get("/", app.GetDraw)
+				r.Get("/history", app.DrawHistory)
+				r.Get("/events", app.DrawEvents)
+				r.Get("/events/ws", app.DrawEventsWS)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.requireUser, app.drawAccess)
+
+				r.Post("/close", app.CloseDraw)
+				r.Post("/entries", app.AddEntry)
+				r.Delete("/entries/{name}", app.RemoveEntry)
+				r.Put("/plan", app.SetPlan)
+				r.Get("/plan", app.GetPlan)
+				r.With(app.rateLimited("draw")).Post("/rounds/next", app.NextRound)
+				r.With(app.rateLimited("draw")).Post("/redraw", app.Redraw)
+				r.Get("/seed", app.DrawSeed)
+				r.Get("/shares", app.GetShares)
+				r.Post("/shares", app.ShareDraw)
+				r.Delete("/shares/{user}", app.UnshareDraw)
+				r.Post("/share-link", app.CreateShareLink)
+				r.Delete("/share-link", app.RevokeShareLink)
+			})
+
+			// results stay exportable after the draw expired, the handler checks access
+			r.With(app.requireUser).Get("/export", app.ExportDraw)
+		})
+
+		r.Post("/draws/verify", app.VerifyDraw)
+		r.With(app.rateLimited("restaurant")).Post("/restaurant/draw", app.DrawRestaurants)
+		r.Get("/restaurant/polls/{id}", app.GetPoll)
+		r.With(app.requireUser).Post("/restaurant/polls/{id}/votes", app.VotePoll)
+		r.Get("/restaurant/polls/{id}/events", app.PollEvents)
 	})
 
 	mux.NotFound(app.HandleNotFound)
 
+	if app.Spec != nil {
+		err := checkSpecRoutes(mux, app.Spec.Doc)
+		if err != nil {
+			log.Panic("routes do not match the openapi document: ", err)
+		}
+	}
+
 	return mux
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/redis/go-redis/v9"
+)
+
+var errReadOnlyShare = newError(CodeForbidden, "share tokens only allow reading the draw")
+
+type ShareLink struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func shareTokenKey(token string) string {
+	return fmt.Sprintf("share:%s", token)
+}
+
+// shareLinkKey points back to the current token so it can be replaced or revoked
+func shareLinkKey(uId string) string {
+	return fmt.Sprintf("draw:%s:share", uId)
+}
+
+// shareToken reads a read only token from the X-Share-Token header or the share query
+// parameter, which is all a browser EventSource can send
+func shareToken(r *http.Request) string {
+	if token := r.Header.Get("X-Share-Token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("share")
+}
+
+// checkDrawReadAccess lets a valid share token through, everyone else needs draw access
+func (app *Config) checkDrawReadAccess(ctx context.Context, r *http.Request, uId string) error {
+	token := shareToken(r)
+	if token == "" || authUser(r) != "" {
+		if authUser(r) == "" {
+			return errUnauthorized
+		}
+		return app.checkDrawAccess(ctx, r, uId)
+	}
+
+	sharedId, err := app.Rdb.Get(ctx, shareTokenKey(token)).Result()
+	if errors.Is(err, redis.Nil) || (err == nil && sharedId != uId) {
+		return newError(CodeForbidden, "invalid share token")
+	}
+	return err
+}
+
+// drawReadAccess guards the /draws/{id} routes participants may follow
+func (app *Config) drawReadAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := app.checkDrawReadAccess(context.Background(), r, chi.URLParam(r, "id"))
+		if err != nil {
+			app.errorJson(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *Config) revokeShareLink(ctx context.Context, uId string) error {
+	token, err := app.Rdb.GetDel(ctx, shareLinkKey(uId)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return app.Rdb.Del(ctx, shareTokenKey(token)).Err()
+}
+
+// CreateShareLink issues a new read only token, the previous one stops working
+func (app *Config) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	meta, err := app.ownerOnly(ctx, r, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	err = app.revokeShareLink(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	b := make([]byte, 24)
+	_, err = rand.Read(b)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	link := ShareLink{
+		Token:     hex.EncodeToString(b),
+		ExpiresAt: meta.ExpiresAt.Add(drawRetention),
+	}
+
+	pipe := app.Rdb.TxPipeline()
+	pipe.Set(ctx, shareTokenKey(link.Token), uId, 0)
+	pipe.ExpireAt(ctx, shareTokenKey(link.Token), link.ExpiresAt)
+	pipe.Set(ctx, shareLinkKey(uId), link.Token, 0)
+	pipe.ExpireAt(ctx, shareLinkKey(uId), link.ExpiresAt)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    link,
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
+
+func (app *Config) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uId := chi.URLParam(r, "id")
+
+	_, err := app.ownerOnly(ctx, r, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	err = app.revokeShareLink(ctx, uId)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	payload := JsonResponse{
+		Status:  "200",
+		Message: "",
+		Data:    struct{}{},
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
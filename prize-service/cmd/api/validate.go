@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxEntries     = 10000
+	maxEntryLength = 100
+)
+
+type RejectedEntry struct {
+	Index  int    `json:"index"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+type ValidationError struct {
+	Message  string          `json:"-"`
+	Rejected []RejectedEntry `json:"rejected"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// normalizeName trims the name and collapses inner whitespace to single spaces
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+type entryChecker struct {
+	// label names the position in rejection reasons, an entry index or a file line
+	label      string
+	ignoreCase bool
+	seen       map[string]int
+	rejected   []RejectedEntry
+}
+
+func newEntryChecker(ignoreCase bool) *entryChecker {
+	return &entryChecker{label: "entry", ignoreCase: ignoreCase, seen: map[string]int{}}
+}
+
+// check returns the normalized name and whether it was accepted
+func (c *entryChecker) check(index int, raw string) (string, bool) {
+	name := normalizeName(raw)
+
+	reason := ""
+	key := name
+	if c.ignoreCase {
+		key = strings.ToLower(name)
+	}
+
+	if first, ok := c.seen[key]; ok {
+		reason = fmt.Sprintf("duplicate of %s %d", c.label, first)
+	}
+	switch {
+	case name == "":
+		reason = "empty name"
+	case utf8.RuneCountInString(name) > maxEntryLength:
+		reason = fmt.Sprintf("longer than %d characters", maxEntryLength)
+	}
+
+	if reason != "" {
+		c.reject(index, raw, reason)
+		return "", false
+	}
+
+	c.seen[key] = index
+	return name, true
+}
+
+func (c *entryChecker) reject(index int, value, reason string) {
+	c.rejected = append(c.rejected, RejectedEntry{Index: index, Value: value, Reason: reason})
+}
+
+func (c *entryChecker) err(total int) error {
+	if len(c.rejected) == 0 {
+		return nil
+	}
+	return &ValidationError{
+		Message:  fmt.Sprintf("%d of %d entries were rejected", len(c.rejected), total),
+		Rejected: c.rejected,
+	}
+}
+
+func checkEntryCount(count int) error {
+	if count == 0 {
+		return &ValidationError{Message: "at least one entry is required", Rejected: []RejectedEntry{}}
+	}
+	if count > maxEntries {
+		return &ValidationError{
+			Message:  fmt.Sprintf("too many entries: %d, the limit is %d", count, maxEntries),
+			Rejected: []RejectedEntry{},
+		}
+	}
+	return nil
+}
+
+func validateNames(names []string, ignoreCase bool) ([]string, error) {
+	err := checkEntryCount(len(names))
+	if err != nil {
+		return nil, err
+	}
+
+	checker := newEntryChecker(ignoreCase)
+	valid := make([]string, 0, len(names))
+
+	for i, raw := range names {
+		if name, ok := checker.check(i, raw); ok {
+			valid = append(valid, name)
+		}
+	}
+
+	return valid, checker.err(len(names))
+}
+
+func validateEntries(entries []DrawEntry, ignoreCase bool) ([]DrawEntry, error) {
+	err := checkEntryCount(len(entries))
+	if err != nil {
+		return nil, err
+	}
+
+	checker := newEntryChecker(ignoreCase)
+	valid := make([]DrawEntry, 0, len(entries))
+
+	for i, entry := range entries {
+		if entry.Weight < 1 || entry.Quantity < 1 {
+			checker.reject(i, entry.Name, "weight and quantity must be at least 1")
+			continue
+		}
+
+		name, ok := checker.check(i, entry.Name)
+		if !ok {
+			continue
+		}
+		entry.Name = name
+		valid = append(valid, entry)
+	}
+
+	return valid, checker.err(len(entries))
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func rejectedIndexes(t *testing.T, err error) []int {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error %v is not a ValidationError", err)
+	}
+
+	indexes := []int{}
+	for _, rejected := range validationErr.Rejected {
+		indexes = append(indexes, rejected.Index)
+	}
+	return indexes
+}
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		name         string
+		names        []string
+		ignoreCase   bool
+		want         []string
+		wantRejected []int
+		wantErr      string
+	}{
+		{
+			name:  "normalizes whitespace",
+			names: []string{"  Alice ", "Bob\t Smith", "Carol"},
+			want:  []string{"Alice", "Bob Smith", "Carol"},
+		},
+		{
+			name:         "rejects empty names",
+			names:        []string{"Alice", "   ", ""},
+			want:         []string{"Alice"},
+			wantRejected: []int{1, 2},
+			wantErr:      "2 of 3 entries were rejected",
+		},
+		{
+			name:         "duplicates after normalizing",
+			names:        []string{"Alice", " Alice", "Bob"},
+			want:         []string{"Alice", "Bob"},
+			wantRejected: []int{1},
+		},
+		{
+			name:  "case matters by default",
+			names: []string{"alice", "Alice"},
+			want:  []string{"alice", "Alice"},
+		},
+		{
+			name:         "ignore case",
+			names:        []string{"alice", "ALICE"},
+			ignoreCase:   true,
+			want:         []string{"alice"},
+			wantRejected: []int{1},
+		},
+		{
+			name:         "too long",
+			names:        []string{strings.Repeat("a", maxEntryLength+1), strings.Repeat("b", maxEntryLength)},
+			want:         []string{strings.Repeat("b", maxEntryLength)},
+			wantRejected: []int{0},
+		},
+		{
+			name:  "length counts characters",
+			names: []string{strings.Repeat("é", maxEntryLength)},
+			want:  []string{strings.Repeat("é", maxEntryLength)},
+		},
+		{
+			name:    "no names",
+			names:   []string{},
+			wantErr: "at least one entry is required",
+		},
+		{
+			name:    "too many names",
+			names:   make([]string, maxEntries+1),
+			wantErr: "too many entries",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateNames(tt.names, tt.ignoreCase)
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if !slices.Equal(rejectedIndexes(t, err), tt.wantRejected) {
+				t.Errorf("rejected = %v, want %v", rejectedIndexes(t, err), tt.wantRejected)
+			}
+			if tt.want != nil && !slices.Equal(got, tt.want) {
+				t.Errorf("names = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEntries(t *testing.T) {
+	tests := []struct {
+		name         string
+		entries      []DrawEntry
+		ignoreCase   bool
+		want         []DrawEntry
+		wantRejected []int
+	}{
+		{
+			name: "keeps weight quantity and group",
+			entries: []DrawEntry{
+				{Name: " Grand  prize ", Weight: 3, Quantity: 2, Group: "vip"},
+				{Name: "Mug", Weight: 1, Quantity: 1},
+			},
+			want: []DrawEntry{
+				{Name: "Grand prize", Weight: 3, Quantity: 2, Group: "vip"},
+				{Name: "Mug", Weight: 1, Quantity: 1},
+			},
+		},
+		{
+			name: "weight or quantity below one",
+			entries: []DrawEntry{
+				{Name: "a", Weight: -1, Quantity: 1},
+				{Name: "b", Weight: 1, Quantity: -1},
+				{Name: "c", Weight: 0, Quantity: 1},
+				{Name: "d", Weight: 1, Quantity: 0},
+				{Name: "e", Weight: 1, Quantity: 1},
+			},
+			want:         []DrawEntry{{Name: "e", Weight: 1, Quantity: 1}},
+			wantRejected: []int{0, 1, 2, 3},
+		},
+		{
+			name: "duplicates",
+			entries: []DrawEntry{
+				{Name: "Mug", Weight: 1, Quantity: 1},
+				{Name: "mug", Weight: 2, Quantity: 1},
+			},
+			ignoreCase:   true,
+			want:         []DrawEntry{{Name: "Mug", Weight: 1, Quantity: 1}},
+			wantRejected: []int{1},
+		},
+		{
+			name:         "empty name",
+			entries:      []DrawEntry{{Name: " ", Weight: 1, Quantity: 1}, {Name: "Mug", Weight: 1, Quantity: 1}},
+			want:         []DrawEntry{{Name: "Mug", Weight: 1, Quantity: 1}},
+			wantRejected: []int{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateEntries(tt.entries, tt.ignoreCase)
+
+			if !slices.Equal(rejectedIndexes(t, err), tt.wantRejected) {
+				t.Errorf("rejected = %v, want %v", rejectedIndexes(t, err), tt.wantRejected)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("entries = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := validateEntries(nil, false)
+	if err == nil || err.Error() != "at least one entry is required" {
+		t.Errorf("validateEntries(nil) error = %v", err)
+	}
+}
+
+func TestDecodeEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want AddEntryRequest
+	}{
+		{
+			name: "left out fields default to one",
+			body: `{"name":"Mug","ignoreCase":true}`,
+			want: AddEntryRequest{DrawEntry: DrawEntry{Name: "Mug", Weight: 1, Quantity: 1}, IgnoreCase: true},
+		},
+		{
+			name: "sent zeros stay zero",
+			body: `{"name":"Mug","weight":0,"quantity":0}`,
+			want: AddEntryRequest{DrawEntry: DrawEntry{Name: "Mug"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got AddEntryRequest
+			err := json.Unmarshal([]byte(tt.body), &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("decoded = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package data
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type DrawHistoryEntry struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	DrawID    string        `bson:"draw_id" json:"draw_id"`
+	Winner    string        `bson:"winner" json:"winner"`
+	Requester string        `bson:"requester" json:"requester"`
+	Remaining int64         `bson:"remaining" json:"remaining"`
+	Round     int           `bson:"round,omitempty" json:"round,omitempty"`
+	Prize     string        `bson:"prize,omitempty" json:"prize,omitempty"`
+	Timestamp time.Time     `bson:"timestamp" json:"timestamp"`
+	// a forfeited winner was not there to claim the prize and got redrawn
+	Forfeited   bool       `bson:"forfeited,omitempty" json:"forfeited,omitempty"`
+	ForfeitedAt *time.Time `bson:"forfeited_at,omitempty" json:"forfeited_at,omitempty"`
+}
+
+func (h *DrawHistoryEntry) InsertMany(entries []DrawHistoryEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	defer cancel()
+	collection := client.Database("restaurants").Collection("draw_history")
+
+	for i := range entries {
+		entries[i].ID = bson.ObjectID{}
+		if entries[i].Timestamp.IsZero() {
+			entries[i].Timestamp = time.Now()
+		}
+	}
+
+	// ordered so the generated ids keep the draw order
+	opts := options.InsertMany().SetOrdered(true)
+	_, err := collection.InsertMany(ctx, entries, opts)
+	if err != nil {
+		log.Println("Error inserting draw history:", err)
+		return err
+	}
+
+	return nil
+}
+
+func (h *DrawHistoryEntry) AllByDraw(drawID string) ([]*DrawHistoryEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	defer cancel()
+	collection := client.Database("restaurants").Collection("draw_history")
+
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := collection.Find(ctx, bson.M{"draw_id": drawID}, opts)
+	if err != nil {
+		log.Println("Finding draw history error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	history := []*DrawHistoryEntry{}
+
+	for cursor.Next(ctx) {
+		var item DrawHistoryEntry
+
+		err := cursor.Decode(&item)
+		if err != nil {
+			log.Println("Error decoding draw history into slice", err)
+			return nil, err
+		}
+		history = append(history, &item)
+	}
+	return history, nil
+}
+
+// LastByDraw returns the latest winner of the draw that was not forfeited
+func (h *DrawHistoryEntry) LastByDraw(drawID string) (*DrawHistoryEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	defer cancel()
+	collection := client.Database("restaurants").Collection("draw_history")
+
+	opts := options.FindOne()
+	opts.SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+
+	var entry DrawHistoryEntry
+
+	err := collection.FindOne(ctx, bson.M{"draw_id": drawID, "forfeited": bson.M{"$ne": true}}, opts).Decode(&entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Forfeit marks the entry forfeited, it returns mongo.ErrNoDocuments when the
+// entry does not exist or was already forfeited
+func (h *DrawHistoryEntry) Forfeit(id bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	defer cancel()
+	collection := client.Database("restaurants").Collection("draw_history")
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": id, "forfeited": bson.M{"$ne": true}},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "forfeited", Value: true},
+				{Key: "forfeited_at", Value: time.Now()},
+			}},
+		},
+	)
+	if err != nil {
+		log.Println("Error forfeiting draw history:", err)
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Unforfeit clears the forfeit again, used when no replacement could be drawn
+func (h *DrawHistoryEntry) Unforfeit(id bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	defer cancel()
+	collection := client.Database("restaurants").Collection("draw_history")
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.D{
+			{Key: "$unset", Value: bson.D{
+				{Key: "forfeited", Value: ""},
+				{Key: "forfeited_at", Value: ""},
+			}},
+		},
+	)
+	if err != nil {
+		log.Println("Error restoring draw history:", err)
+		return err
+	}
+
+	return nil
+}
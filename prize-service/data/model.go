@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"log"
+	"regexp"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -16,13 +17,15 @@ func New(mongo *mongo.Client) Models {
 	client = mongo
 
 	return Models{
-		RestaurantEntry: RestaurantEntry{},
+		RestaurantEntry:  RestaurantEntry{},
+		DrawHistoryEntry: DrawHistoryEntry{},
 	}
 
 }
 
 type Models struct {
-	RestaurantEntry RestaurantEntry
+	RestaurantEntry  RestaurantEntry
+	DrawHistoryEntry DrawHistoryEntry
 }
 
 type RestaurantEntry struct {
@@ -32,10 +35,22 @@ type RestaurantEntry struct {
 	Rating    float64       `json:"rating"`
 	PlaceID   string        `json:"place_id"`
 	Area      string        `json:"area"`
+	Types     []string      `json:"types,omitempty"`
+	Location  *GeoPoint     `bson:"location,omitempty" json:"location,omitempty"`
 	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
 }
 
+// GeoPoint is a GeoJSON point, coordinates are longitude first
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
 func (r *RestaurantEntry) EnsureUniqueIndex() error {
 	collection := client.Database("restaurants").Collection("restaurants")
 
@@ -57,25 +72,46 @@ func (r *RestaurantEntry) EnsureUniqueIndex() error {
 	return nil
 }
 
-func (r *RestaurantEntry) Insert(entry RestaurantEntry) error {
+// EnsureGeoIndex creates the 2dsphere index $geoNear needs on location
+func (r *RestaurantEntry) EnsureGeoIndex() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	collection := client.Database("restaurants").Collection("restaurants")
+
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		log.Printf("Error creating geo index: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *RestaurantEntry) Insert(entry RestaurantEntry) (bson.ObjectID, error) {
 	collection := client.Database("restaurants").Collection("restaurants")
 
-	_, err := collection.InsertOne(context.TODO(), RestaurantEntry{
+	result, err := collection.InsertOne(context.TODO(), RestaurantEntry{
 		Name:      entry.Name,
 		Address:   entry.Address,
 		Rating:    entry.Rating,
 		PlaceID:   entry.PlaceID,
 		Area:      entry.Area,
+		Types:     entry.Types,
+		Location:  entry.Location,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	})
 
 	if err != nil {
 		log.Println("Error inserting into logs:", err)
-		return err
+		return bson.NilObjectID, err
 	}
 
-	return nil
+	return result.InsertedID.(bson.ObjectID), nil
 }
 
 func (r *RestaurantEntry) InsertMany(entrys []RestaurantEntry) error {
@@ -113,6 +149,7 @@ func (l *RestaurantEntry) All() ([]*RestaurantEntry, error) {
 
 	if err != nil {
 		log.Println("Finding all doc error", err)
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 
@@ -132,6 +169,132 @@ func (l *RestaurantEntry) All() ([]*RestaurantEntry, error) {
 	return restaurants, nil
 }
 
+// RestaurantFilter narrows the catalog down, empty fields match everything
+type RestaurantFilter struct {
+	// any of them matches, case does not matter
+	Areas     []string
+	MinRating float64
+	Types     []string
+	// place ids, or the ids of places saved without one, to leave out
+	Exclude []string
+	// with Near set only places within Radius meters of it match
+	Near   *GeoPoint
+	Radius float64
+}
+
+// anyOf matches a field against the values ignoring case, array fields match
+// when one of their elements does
+func anyOf(values []string) bson.M {
+	patterns := make(bson.A, 0, len(values))
+	for _, value := range values {
+		patterns = append(patterns, bson.Regex{Pattern: "^" + regexp.QuoteMeta(value) + "$", Options: "i"})
+	}
+	return bson.M{"$in": patterns}
+}
+
+func (f RestaurantFilter) query() bson.M {
+	query := bson.M{}
+	if len(f.Areas) > 0 {
+		query["area"] = anyOf(f.Areas)
+	}
+	if f.MinRating > 0 {
+		query["rating"] = bson.M{"$gte": f.MinRating}
+	}
+	if len(f.Types) > 0 {
+		query["types"] = anyOf(f.Types)
+	}
+
+	if len(f.Exclude) > 0 {
+		ids := bson.A{}
+		for _, id := range f.Exclude {
+			if docId, err := bson.ObjectIDFromHex(id); err == nil {
+				ids = append(ids, docId)
+			}
+		}
+		query["placeid"] = bson.M{"$nin": f.Exclude}
+		query["_id"] = bson.M{"$nin": ids}
+	}
+	return query
+}
+
+// matching is the first stage of a pipeline over the restaurants the filter lets through
+func (f RestaurantFilter) matching() bson.D {
+	if f.Near == nil {
+		return bson.D{{Key: "$match", Value: f.query()}}
+	}
+	return bson.D{{Key: "$geoNear", Value: bson.D{
+		{Key: "near", Value: f.Near},
+		{Key: "distanceField", Value: "distance"},
+		{Key: "maxDistance", Value: f.Radius},
+		{Key: "spherical", Value: true},
+		{Key: "query", Value: f.query()},
+	}}}
+}
+
+type NearbyRestaurant struct {
+	RestaurantEntry `bson:",inline"`
+	// meters from the point the search started at, only set with RestaurantFilter.Near
+	Distance float64 `bson:"distance"`
+}
+
+// Sample picks up to count random restaurants that match the filter
+func (r *RestaurantEntry) Sample(filter RestaurantFilter, count int) ([]*NearbyRestaurant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	defer cancel()
+	collection := client.Database("restaurants").Collection("restaurants")
+
+	pipeline := mongo.Pipeline{
+		filter.matching(),
+		{{Key: "$sample", Value: bson.D{{Key: "size", Value: count}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println("Sampling restaurants error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	restaurants := []*NearbyRestaurant{}
+
+	err = cursor.All(ctx, &restaurants)
+	if err != nil {
+		log.Println("Error decoding sampled restaurants", err)
+		return nil, err
+	}
+	return restaurants, nil
+}
+
+// Count is how many restaurants match the filter
+func (r *RestaurantEntry) Count(filter RestaurantFilter) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	defer cancel()
+	collection := client.Database("restaurants").Collection("restaurants")
+
+	pipeline := mongo.Pipeline{
+		filter.matching(),
+		{{Key: "$count", Value: "matching"}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println("Counting restaurants error", err)
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Matching int64 `bson:"matching"`
+	}
+	err = cursor.All(ctx, &result)
+	if err != nil || len(result) == 0 {
+		return 0, err
+	}
+	return result[0].Matching, nil
+}
+
 func (r *RestaurantEntry) GetOne(id string) (*RestaurantEntry, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 
@@ -167,33 +330,43 @@ func (r *RestaurantEntry) GetOne(id string) (*RestaurantEntry, error) {
 // 	return nil
 // }
 
-// func (l *RestaurantEntry) Update() (*mongo.UpdateResult, error) {
-// 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+// Update writes every editable field of the entry back, ID picks the document
+func (r *RestaurantEntry) Update() (*mongo.UpdateResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 
-// 	defer cancel()
-// 	collection := client.Database("logs").Collection("logs")
+	defer cancel()
+	collection := client.Database("restaurants").Collection("restaurants")
 
-// 	docId, err := bson.ObjectIDFromHex(l.ID)
-// 	if err != nil {
-// 		return nil, err
-// 	}
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": r.ID},
+		bson.D{
+			{
+				Key: "$set", Value: bson.D{
+					{Key: "name", Value: r.Name},
+					{Key: "address", Value: r.Address},
+					{Key: "rating", Value: r.Rating},
+					{Key: "placeid", Value: r.PlaceID},
+					{Key: "area", Value: r.Area},
+					{Key: "types", Value: r.Types},
+					{Key: "location", Value: r.Location},
+					{Key: "updated_at", Value: time.Now()},
+				}},
+		},
+	)
 
-// 	result, err := collection.UpdateOne(ctx,
-// 		bson.M{"_id": docId},
-// 		bson.D{
-// 			{
-// 				"$set", bson.D{
-// 					{"name", l.Name},
-// 					{"data", l.Data},
-// 					{"updated_at", time.Now()},
-// 				}},
-// 		},
-// 	)
-
-// 	if err != nil {
-// 		return nil, err
-// 	}
+	if err != nil {
+		return nil, err
+	}
 
-// 	return result, nil
+	return result, nil
 
-// }
+}
+
+func (r *RestaurantEntry) Delete(id bson.ObjectID) (*mongo.DeleteResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+
+	defer cancel()
+	collection := client.Database("restaurants").Collection("restaurants")
+
+	return collection.DeleteOne(ctx, bson.M{"_id": id})
+}